@@ -2,15 +2,16 @@
 package main
 
 import (
-	"github.com/nareix/mp4"
+	"github.com/seifer/go-mp4/stream"
 	"os"
 	"fmt"
 	"encoding/hex"
+	"time"
 )
 
 func DemuxExample() {
 	file, _ := os.Open("test.mp4")
-	demuxer := &mp4.Demuxer{R: file}
+	demuxer := &stream.Demuxer{R: file}
 	demuxer.ReadHeader()
 
 	fmt.Println("Total tracks: ", len(demuxer.Tracks))
@@ -19,7 +20,7 @@ func DemuxExample() {
 	count := demuxer.TrackH264.SampleCount()
 	fmt.Println("SampleCount: ", count)
 
-	demuxer.TrackH264.SeekToTime(2.3)
+	demuxer.TrackH264.SeekToTime(2300 * time.Millisecond)
 
 	var sample []byte
 	for i := 0; i < 5; i++ {
@@ -38,7 +39,7 @@ func DemuxExample() {
 
 	fmt.Println("Duration(AAC): ", demuxer.TrackAAC.Duration())
 	fmt.Println("SampleCount(AAC): ", demuxer.TrackAAC.SampleCount())
-	demuxer.TrackAAC.SeekToTime(1.3)
+	demuxer.TrackAAC.SeekToTime(1300 * time.Millisecond)
 
 	for i := 0; i < 5; i++ {
 		pts, dts, isKeyFrame, data, err := demuxer.TrackAAC.ReadSample()
@@ -59,14 +60,16 @@ func MuxExample() {
 	infile, _ := os.Open("test.mp4")
 	outfile, _ := os.Create("test.out.mp4")
 
-	demuxer := &mp4.Demuxer{R: infile}
+	demuxer := &stream.Demuxer{R: infile}
 	demuxer.ReadHeader()
 
-	muxer := &mp4.Muxer{W: outfile}
+	muxer := &stream.Muxer{W: outfile}
 	muxer.AddH264Track()
 	muxer.TrackH264.SetH264PPS(demuxer.TrackH264.GetH264PPS())
 	muxer.TrackH264.SetH264SPS(demuxer.TrackH264.GetH264SPS())
 	muxer.TrackH264.SetTimeScale(demuxer.TrackH264.TimeScale())
+	tkhd := demuxer.TrackH264.Trak.Tkhd
+	muxer.TrackH264.SetResolution(uint16(tkhd.Width>>16), uint16(tkhd.Height>>16))
 	muxer.WriteHeader()
 	for {
 		pts, dts, isKeyFrame, data, err := demuxer.TrackH264.ReadSample()
@@ -1,9 +1,10 @@
 package main
 import (
 	"os"
-	"github.com/nareix/mp4"
+	"github.com/seifer/go-mp4/stream"
 	"fmt"
 	"encoding/hex"
+	"time"
 )
 
 
@@ -15,21 +16,21 @@ func main()  {
 func myDemux(){
 	file, _ := os.Open("videos/tth_dashinit.mp4")
 	fileInfo, _ := file.Stat()
-	demuxer := &mp4.Demuxer{R: file}
+	demuxer := &stream.Demuxer{R: file}
 	demuxer.ReadHeader()
 
 	fmt.Println("File Size: ", fileInfo.Size(),  " bytes")
 	fmt.Println("Total tracks: ", len(demuxer.Tracks))
 	fmt.Println("Duration: ", demuxer.TrackH264.Duration())
-	fmt.Println("Created Time: ", demuxer.MovieAtom.Header.CreateTime)
-	fmt.Println("Time Scale: ", demuxer.MovieAtom.Header.TimeScale)
-	fmt.Println("Track 0: ", demuxer.Tracks[0].TrackAtom.Header)
+	fmt.Println("Created Time: ", demuxer.MP4.Moov.Mvhd.CreationTime)
+	fmt.Println("Time Scale: ", demuxer.MP4.Moov.Mvhd.Timescale)
+	fmt.Println("Track 0: ", demuxer.Tracks[0].Trak.Tkhd)
 }
 
 func DemuxExample() {
 	file, _ := os.Open("videos/tth_dashinit.mp4")
 	fileInfo, _ := file.Stat()
-	demuxer := &mp4.Demuxer{R: file}
+	demuxer := &stream.Demuxer{R: file}
 	demuxer.ReadHeader()
 
 	fmt.Println("File Size: ", fileInfo.Size(),  " bytes")
@@ -39,7 +40,7 @@ func DemuxExample() {
 	count := demuxer.TrackH264.SampleCount()
 	fmt.Println("SampleCount: ", count)
 
-	demuxer.TrackH264.SeekToTime(2.3)
+	demuxer.TrackH264.SeekToTime(2300 * time.Millisecond)
 
 	var sample []byte
 	for i := 0; i < 5; i++ {
@@ -58,7 +59,7 @@ func DemuxExample() {
 
 	fmt.Println("Duration(AAC): ", demuxer.TrackAAC.Duration())
 	fmt.Println("SampleCount(AAC): ", demuxer.TrackAAC.SampleCount())
-	demuxer.TrackAAC.SeekToTime(1.3)
+	demuxer.TrackAAC.SeekToTime(1300 * time.Millisecond)
 
 	for i := 0; i < 5; i++ {
 		pts, dts, isKeyFrame, data, err := demuxer.TrackAAC.ReadSample()
@@ -79,14 +80,16 @@ func MuxExample() {
 //	infile, _ := os.Open("test.mp4")
 //	outfile, _ := os.Create("test.out.mp4")
 //
-//	demuxer := &mp4.Demuxer{R: infile}
+//	demuxer := &stream.Demuxer{R: infile}
 //	demuxer.ReadHeader()
 //
-//	muxer := &mp4.Muxer{W: outfile}
+//	muxer := &stream.Muxer{W: outfile}
 //	muxer.AddH264Track()
 //	muxer.TrackH264.SetH264PPS(demuxer.TrackH264.GetH264PPS())
 //	muxer.TrackH264.SetH264SPS(demuxer.TrackH264.GetH264SPS())
 //	muxer.TrackH264.SetTimeScale(demuxer.TrackH264.TimeScale())
+//	tkhd := demuxer.TrackH264.Trak.Tkhd
+//	muxer.TrackH264.SetResolution(uint16(tkhd.Width>>16), uint16(tkhd.Height>>16))
 //	muxer.WriteHeader()
 //	for {
 //		pts, dts, isKeyFrame, data, err := demuxer.TrackH264.ReadSample()
@@ -1,40 +1,107 @@
 package stream
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"sort"
+	"strings"
 )
 
 const (
-	BoxHeaderSize = 8
+	BoxHeaderSize      = 8
+	LargeBoxHeaderSize = 16
 )
 
 var (
 	ErrTruncatedHeader = errors.New("truncated header")
+	ErrTruncatedBox    = errors.New("truncated box")
+	ErrInvalidBoxSize  = errors.New("invalid box size")
+	ErrMissingBox      = errors.New("mandatory box is missing")
 )
 
+// The content of a box (or a sample) larger than maxPrealloc is read without allocating its size first:
+// the size given by the media isn't trusted until the data has been read.
+const maxPrealloc = 1 << 20
+
+// A DecodeError is returned when a media can't be decoded
+//
+// Path and Offset locate the invalid box as in BoxReader: Path lists the types of its parents and its own
+// type, and Offset is its position in the file. When the header of a box is invalid, Path is the path of
+// its container. Err is the cause: ErrTruncatedHeader, ErrTruncatedBox, ErrInvalidBoxSize, ErrMissingBox
+// (wrapped with the type of the missing child), ErrInvalidSampleTable, or the error of the reader.
+type DecodeError struct {
+	Path   []string
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("%s box at offset %d: %v", strings.Join(e.Path, "/"), e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// missingBox returns the error of a container lacking its mandatory child of type ht
+func missingBox(ht string) error {
+	return fmt.Errorf("%s: %w", ht, ErrMissingBox)
+}
+
 var decoders map[string]BoxDecoder
 
 func init() {
 	decoders = map[string]BoxDecoder{
+		"ftyp": DecodeFtyp,
+		"styp": DecodeStyp,
 		"moov": DecodeMoov,
 		"mvhd": DecodeMvhd,
 		"trak": DecodeTrak,
 		"tkhd": DecodeTkhd,
+		"edts": DecodeEdts,
+		"elst": DecodeElst,
 		"mdia": DecodeMdia,
 		"minf": DecodeMinf,
 		"mdhd": DecodeMdhd,
+		"hdlr": DecodeHdlr,
 		"stbl": DecodeStbl,
 		"stco": DecodeStco,
+		"co64": DecodeCo64,
+		"stsd": DecodeStsd,
 		"stsc": DecodeStsc,
 		"stsz": DecodeStsz,
 		"ctts": DecodeCtts,
 		"stts": DecodeStts,
 		"stss": DecodeStss,
+		"mvex": DecodeMvex,
+		"mehd": DecodeMehd,
+		"trex": DecodeTrex,
+		"moof": DecodeMoof,
+		"mfhd": DecodeMfhd,
+		"traf": DecodeTraf,
+		"tfhd": DecodeTfhd,
+		"tfdt": DecodeTfdt,
+		"trun": DecodeTrun,
+		"sidx": DecodeSidx,
+		"mfra": DecodeMfra,
+		"tfra": DecodeTfra,
+		"mfro": DecodeMfro,
 		"mdat": DecodeMdat,
+		"udta": containerDecoder("udta"),
+		"meta": containerDecoder("meta"),
+		"ilst": containerDecoder("ilst"),
+		"dinf": containerDecoder("dinf"),
+		"tref": containerDecoder("tref"),
+		"sinf": containerDecoder("sinf"),
+		"schi": containerDecoder("schi"),
 	}
 }
 
@@ -45,51 +112,247 @@ type Box interface {
 	Encode(w io.Writer) error
 }
 
+// A BoxDecoder decodes the content of a box (header excluded), r being a *BoxReader
 type BoxDecoder func(r io.Reader) (Box, error)
 
 // DecodeContainer decodes a container box
+//
+// The children are decoded by the registered decoders (see RegisterDecoder). When r is the *BoxReader of
+// the container, the children know their paths and offsets.
+//
+// A box with a size of 0 extends to the end of its container (or to the end of the file for top-level boxes),
+// and a box larger than what is left of its container is invalid (ErrInvalidBoxSize).
+//
+// The errors are *DecodeError values, locating the invalid box.
 func DecodeContainer(r io.Reader) (l []Box, err error) {
+	return decodeContainer(r, DecodeUni)
+}
+
+// decodeContainer decodes a container box, the children without a registered decoder being decoded
+// by unknown
+func decodeContainer(r io.Reader, unknown func(io.Reader, string) (Box, error)) (l []Box, err error) {
 	var b Box
-	var ht string
-	var hs uint32
+	var lr io.Reader
+	var offset int64
+
+	parent := boxReader(r)
+	r = parent.Reader
 
-	buf := make([]byte, BoxHeaderSize)
+	buf := make([]byte, LargeBoxHeaderSize)
 
 	for {
-		n, err := r.Read(buf)
+		ht, hs, cs, err := readHeader(r, buf)
 
 		if err != nil {
 			if err == io.EOF {
 				return l, nil
 			} else {
-				return nil, err
+				return nil, parent.headerError(offset, err)
+			}
+		}
+
+		if cs < 0 {
+			if parent, limited := r.(*io.LimitedReader); limited {
+				cs = parent.N
 			}
 		}
 
-		if n != BoxHeaderSize {
-			return nil, ErrTruncatedHeader
+		if lr = r; cs >= 0 {
+			lr = io.LimitReader(r, cs)
 		}
 
-		ht = string(buf[4:8])
-		hs = binary.BigEndian.Uint32(buf[0:4])
+		child := parent.child(lr, ht, offset, hs)
 
-		if d := decoders[ht]; d != nil {
-			b, err = d(io.LimitReader(r, int64(hs-BoxHeaderSize)))
-		} else {
-			b, err = DecodeUni(io.LimitReader(r, int64(hs-BoxHeaderSize)), ht)
+		// A child can't extend past its container (the size of top-level boxes isn't checked against the file)
+		if left := contentLeft(r); len(parent.Path) > 0 && left >= 0 && cs > left {
+			return nil, child.decodeError(ErrInvalidBoxSize)
 		}
 
+		b, err = decodeBoxOr(ht, child, unknown)
+
 		if err != nil {
 			return nil, err
 		}
 
 		l = append(l, b)
+		offset += int64(hs) + cs
 
-		if ht == "mdat" {
-			b.(*MdatBox).ContentSize = hs - BoxHeaderSize
+		// The media data isn't read (unless a decoder is registered for mdat boxes)
+		if mdat, ok := b.(*MdatBox); ok {
+			mdat.largeHeader = hs == LargeBoxHeaderSize
+			if cs < 0 {
+				mdat.toEOF = true
+			} else {
+				mdat.ContentSize = uint64(cs)
+			}
 			return l, nil
 		}
+
+		// The content not read by the decoder is skipped
+		if cs >= 0 {
+			if _, err = io.Copy(ioutil.Discard, lr); err != nil {
+				return nil, child.decodeError(err)
+			}
+		}
+	}
+}
+
+// contentLeft returns the size of the content left in a container, or -1 when it isn't known
+func contentLeft(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *io.LimitedReader:
+		return r.N
+	case *bytes.Reader:
+		return int64(r.Len())
+	}
+	return -1
+}
+
+// readHeader reads a box header. It returns the box type, the header size and the content size.
+//
+// The content size is -1 for a box extending to the end of the file (size 0).
+func readHeader(r io.Reader, buf []byte) (ht string, hs int, cs int64, err error) {
+	if _, err = io.ReadFull(r, buf[:BoxHeaderSize]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrTruncatedHeader
+		}
+		return
+	}
+
+	ht = string(buf[4:8])
+	hs = BoxHeaderSize
+
+	switch sz := uint64(binary.BigEndian.Uint32(buf[0:4])); sz {
+	case 0:
+		cs = -1
+	case 1:
+		if _, err = io.ReadFull(r, buf[BoxHeaderSize:LargeBoxHeaderSize]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrTruncatedHeader
+			}
+			return
+		}
+		hs = LargeBoxHeaderSize
+		sz = binary.BigEndian.Uint64(buf[BoxHeaderSize:LargeBoxHeaderSize])
+		if sz < LargeBoxHeaderSize || sz > math.MaxInt64 {
+			err = ErrInvalidBoxSize
+			return
+		}
+		cs = int64(sz) - LargeBoxHeaderSize
+	default:
+		if sz < BoxHeaderSize {
+			err = ErrInvalidBoxSize
+			return
+		}
+		cs = int64(sz) - BoxHeaderSize
+	}
+
+	return
+}
+
+// boxSize returns the size of a box holding sz bytes of content.
+//
+// Boxes larger than 4GiB need the 64 bits header (largesize).
+func boxSize(sz int) int {
+	if uint64(sz)+BoxHeaderSize > math.MaxUint32 {
+		return sz + LargeBoxHeaderSize
+	}
+	return sz + BoxHeaderSize
+}
+
+// boxesSize returns the size of a list of boxes
+func boxesSize(l []Box) (sz int) {
+	for _, b := range l {
+		sz += b.Size()
 	}
+	return
+}
+
+// hasBox tells whether a list of boxes holds a box of type ht
+func hasBox(l []Box, ht string) bool {
+	for _, b := range l {
+		if b.Type() == ht {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeHeader writes the header of a box of the given type and size (header included).
+//
+// The 64 bits header (largesize) is used when the size doesn't fit in 32 bits, or when large is set.
+func encodeHeader(w io.Writer, ht string, sz int, large bool) (err error) {
+	var buf [LargeBoxHeaderSize]byte
+
+	copy(buf[4:8], ht)
+
+	if large || uint64(sz) > math.MaxUint32 {
+		binary.BigEndian.PutUint32(buf[0:4], 1)
+		binary.BigEndian.PutUint64(buf[8:16], uint64(sz))
+		_, err = w.Write(buf[:])
+		return
+	}
+
+	binary.BigEndian.PutUint32(buf[0:4], uint32(sz))
+	_, err = w.Write(buf[:BoxHeaderSize])
+
+	return
+}
+
+// orderBoxes returns the children l of a container, given in the default order, in the order they were
+// decoded (order), so that an unmodified container is encoded as it was decoded.
+//
+// The decoded children keep their relative positions, an added child follows the child preceding it in
+// l, and removed children are skipped.
+func orderBoxes(order, l []Box) []Box {
+	if len(order) == 0 {
+		return l
+	}
+
+	index := make(map[Box]int, len(order))
+	for i, b := range order {
+		index[b] = i
+	}
+
+	type position struct {
+		box          Box
+		index, added int
+	}
+
+	positions := make([]position, len(l))
+	p := position{index: -1}
+
+	for i, b := range l {
+		if n, ok := index[b]; ok {
+			p = position{index: n}
+		} else {
+			p.added++
+		}
+		p.box = b
+		positions[i] = p
+	}
+
+	sort.SliceStable(positions, func(i, j int) bool {
+		a, b := positions[i], positions[j]
+		return a.index < b.index || a.index == b.index && a.added < b.added
+	})
+
+	boxes := make([]Box, len(l))
+	for i, p := range positions {
+		boxes[i] = p.box
+	}
+
+	return boxes
+}
+
+// encodeChildren writes the children l of a container (see orderBoxes)
+func encodeChildren(w io.Writer, order, l []Box) error {
+	for _, b := range orderBoxes(order, l) {
+		if err := b.Encode(w); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // An 8.8 fixed point number
@@ -123,15 +386,44 @@ func putFixed32(bytes []byte, i Fixed32) {
 }
 
 // Utils
+func flags24(f [3]byte) uint32 {
+	return uint32(f[0])<<16 | uint32(f[1])<<8 | uint32(f[2])
+}
+
+func putFlags24(v uint32) [3]byte {
+	return [3]byte{byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
 func makebuf(b Box) []byte {
 	return make([]byte, b.Size()-BoxHeaderSize)
 }
 
 func readAllO(r io.Reader) ([]byte, error) {
+	if br, ok := r.(*BoxReader); ok {
+		r = br.Reader
+	}
 	if lr, ok := r.(*io.LimitedReader); ok {
-		buf := make([]byte, lr.N)
-		_, err := io.ReadFull(lr, buf)
+		buf, err := readFull(lr, lr.N)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = ErrTruncatedBox
+		}
 		return buf, err
 	}
 	return ioutil.ReadAll(r)
 }
+
+// readFull reads n bytes, n being allocated as the data comes when it is larger than maxPrealloc
+func readFull(r io.Reader, n int64) ([]byte, error) {
+	if n > maxPrealloc {
+		buf, err := ioutil.ReadAll(io.LimitReader(r, n))
+		if err == nil && int64(len(buf)) < n {
+			err = io.ErrUnexpectedEOF
+		}
+		return buf, err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,83 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Chunk Large Offset Box (co64 - optional)
+//
+// Contained in : Sample Table box (stbl)
+//
+// Status: decoded
+//
+// This is the 64bits version of the chunk offset box (stco), used when the media is larger than 4GiB.
+// Only one of stco and co64 is present in a sample table, see StblBox.ChunkOffset.
+type Co64Box struct {
+	Version     byte
+	Flags       [3]byte
+	header      [8]byte
+	ChunkOffset []uint64
+}
+
+func DecodeCo64(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
+	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*8 > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &Co64Box{
+		Flags:       [3]byte{data[1], data[2], data[3]},
+		Version:     data[0],
+		ChunkOffset: make([]uint64, c),
+	}
+
+	for i := 0; i < int(c); i++ {
+		b.ChunkOffset[i] = binary.BigEndian.Uint64(data[(8 + 8*i):(16 + 8*i)])
+	}
+
+	return b, nil
+}
+
+func (b *Co64Box) Type() string {
+	return "co64"
+}
+
+func (b *Co64Box) Size() int {
+	return BoxHeaderSize + 8 + len(b.ChunkOffset)*8
+}
+
+func (b *Co64Box) Dump() {
+	fmt.Println("Chunk byte offsets (64 bits):")
+	for i, o := range b.ChunkOffset {
+		fmt.Printf(" #%d : starts at %d\n", i, o)
+	}
+}
+
+func (b *Co64Box) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(b.ChunkOffset)))
+	for i := range b.ChunkOffset {
+		binary.BigEndian.PutUint64(buf[8+8*i:], b.ChunkOffset[i])
+	}
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Codec returns the codec string (RFC 6381) of the first sample entry of the track: avc1.64001f, mp4a.40.2, ...
+func (b *TrakBox) Codec() string {
+	stsd := b.Mdia.Minf.Stbl.Stsd
+	if stsd == nil || len(stsd.Entries) == 0 {
+		return ""
+	}
+
+	entry := stsd.Entries[0]
+	format := entry.Type()
+
+	var config *UniBox
+
+	switch e := entry.(type) {
+	case *VisualSampleEntry:
+		for _, t := range []string{"avcC", "hvcC", "av1C", "vpcC"} {
+			if c, ok := e.Box(t).(*UniBox); ok {
+				config = c
+				break
+			}
+		}
+	case *AudioSampleEntry:
+		config, _ = e.Box("esds").(*UniBox)
+	}
+
+	if config == nil {
+		return format
+	}
+
+	data := config.buff
+
+	switch config.Type() {
+	case "avcC":
+		// profile, profile compatibility, level
+		if len(data) >= 4 {
+			return fmt.Sprintf("%s.%02x%02x%02x", format, data[1], data[2], data[3])
+		}
+	case "hvcC":
+		if len(data) >= 13 {
+			return format + "." + hevcCodec(data)
+		}
+	case "av1C":
+		if len(data) >= 3 {
+			depth := 8
+			if data[2]&0x40 != 0 {
+				depth = 10
+				if data[2]&0x20 != 0 {
+					depth = 12
+				}
+			}
+			tier := "M"
+			if data[2]&0x80 != 0 {
+				tier = "H"
+			}
+			return fmt.Sprintf("%s.%d.%02d%s.%02d", format, data[1]>>5, data[1]&0x1f, tier, depth)
+		}
+	case "vpcC":
+		// version and flags, then profile, level and bit depth
+		if len(data) >= 7 {
+			return fmt.Sprintf("%s.%02d.%02d.%02d", format, data[4], data[5], data[6]>>4)
+		}
+	case "esds":
+		if oti, dsi := esdsDecoderConfig(data); oti == 0x40 && len(dsi) > 0 {
+			// MPEG-4 audio: audio object type
+			aot := dsi[0] >> 3
+			if aot == 31 && len(dsi) > 1 {
+				aot = 32 + (dsi[0]&7)<<3 | dsi[1]>>5
+			}
+			return fmt.Sprintf("%s.40.%d", format, aot)
+		} else if oti != 0 {
+			return fmt.Sprintf("%s.%02x", format, oti)
+		}
+	}
+
+	return format
+}
+
+// hevcCodec returns the codec string of a HEVCDecoderConfigurationRecord, without the format
+func hevcCodec(data []byte) string {
+	var compat uint32
+
+	// The profile compatibility flags are written in reverse bit order
+	for i := 0; i < 32; i++ {
+		if data[2+i/8]&(0x80>>uint(i%8)) != 0 {
+			compat |= 1 << uint(i)
+		}
+	}
+
+	tier := "L"
+	if data[1]&0x20 != 0 {
+		tier = "H"
+	}
+
+	s := fmt.Sprintf("%s%d.%x.%s%d", []string{"", "A", "B", "C"}[data[1]>>6], data[1]&0x1f, compat, tier, data[12])
+
+	// Constraint flags, trailing zero bytes omitted
+	constraints := data[6:12]
+	for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+		constraints = constraints[:len(constraints)-1]
+	}
+
+	l := []string{s}
+	for _, c := range constraints {
+		l = append(l, fmt.Sprintf("%02x", c))
+	}
+
+	return strings.Join(l, ".")
+}
+
+// esdsDecoderConfig returns the object type indication and the decoder specific info of an esds box
+func esdsDecoderConfig(data []byte) (oti byte, dsi []byte) {
+	if len(data) < 4 {
+		return
+	}
+
+	// ES descriptor
+	tag, es, _ := readDescriptor(data[4:])
+	if tag != 3 || len(es) < 3 {
+		return
+	}
+
+	flags := es[2]
+	es = es[3:]
+
+	if flags&0x80 != 0 && len(es) >= 2 {
+		// streamDependenceFlag
+		es = es[2:]
+	}
+	if flags&0x40 != 0 && len(es) >= 1 && len(es) >= 1+int(es[0]) {
+		// URL_Flag
+		es = es[1+int(es[0]):]
+	}
+	if flags&0x20 != 0 && len(es) >= 2 {
+		// OCRstreamFlag
+		es = es[2:]
+	}
+
+	// Decoder config descriptor
+	tag, dcd, _ := readDescriptor(es)
+	if tag != 4 || len(dcd) < 13 {
+		return
+	}
+
+	oti = dcd[0]
+
+	if tag, body, _ := readDescriptor(dcd[13:]); tag == 5 {
+		dsi = body
+	}
+
+	return
+}
+
+// readDescriptor reads a MPEG-4 descriptor (tag, size, body)
+func readDescriptor(data []byte) (tag byte, body []byte, rest []byte) {
+	if len(data) < 2 {
+		return
+	}
+
+	n := 0
+	i := 1
+
+	for ; i < len(data) && i <= 4; i++ {
+		n = n<<7 | int(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			break
+		}
+	}
+
+	if i >= len(data) || len(data) < i+1+n {
+		return
+	}
+
+	return data[0], data[i+1 : i+1+n], data[i+1+n:]
+}
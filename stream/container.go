@@ -0,0 +1,130 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// A container box which isn't typed (udta, meta, ilst, dinf, tref, sinf, schi)
+//
+// Status: decoded (its children)
+//
+// Header holds the fields preceding the children: the version and flags of the meta box (a QuickTime
+// meta box has none). The children of ilst, the metadata items (©nam, ©ART, covr, ...), are containers
+// too, holding data boxes.
+//
+// QuickTime user data (udta) may end with a 32 bits zero terminator, which is kept.
+type ContainerBox struct {
+	name    string
+	Header  []byte
+	boxes   []Box
+	trailer []byte
+}
+
+// NewContainerBox returns a container box of the given type
+func NewContainerBox(name string, children ...Box) *ContainerBox {
+	return &ContainerBox{
+		name:  name,
+		boxes: children,
+	}
+}
+
+// containerDecoder returns the decoder of a container box of the given type
+func containerDecoder(name string) BoxDecoder {
+	return func(r io.Reader) (Box, error) {
+		return decodeContainerBox(r, name)
+	}
+}
+
+func decodeContainerBox(r io.Reader, name string) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &ContainerBox{name: name}
+
+	// The meta box is a full box, except in QuickTime medias where it begins with the hdlr box
+	if name == "meta" && len(data) >= 4 && !(len(data) >= 8 && string(data[4:8]) == "hdlr") {
+		b.Header = data[:4]
+	}
+
+	// The items of ilst have any type
+	item := DecodeUni
+	if name == "ilst" {
+		item = decodeContainerBox
+	}
+
+	n, end := len(b.Header), len(data)
+
+	if name == "udta" && terminated(data[n:]) {
+		b.trailer = data[end-4:]
+		end -= 4
+	}
+
+	if b.boxes, err = decodeContainer(boxReader(r).content(data[n:end], int64(n)), item); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func (b *ContainerBox) Type() string {
+	return b.name
+}
+
+func (b *ContainerBox) Size() int {
+	return boxSize(len(b.Header) + boxesSize(b.boxes) + len(b.trailer))
+}
+
+func (b *ContainerBox) Dump() {
+	fmt.Printf("%s:", b.name)
+	for _, c := range b.boxes {
+		fmt.Printf(" %s", c.Type())
+	}
+	fmt.Println()
+}
+
+// Children returns the children of the box
+func (b *ContainerBox) Children() []Box {
+	return b.boxes
+}
+
+// SetChildren replaces the children of the box
+func (b *ContainerBox) SetChildren(l []Box) {
+	b.boxes = l
+}
+
+func (b *ContainerBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(b.Header); err != nil {
+		return err
+	}
+
+	if err := encodeChildren(w, nil, b.boxes); err != nil {
+		return err
+	}
+
+	_, err := w.Write(b.trailer)
+
+	return err
+}
+
+// terminated tells whether the boxes listed in data are followed by a 32 bits zero terminator
+func terminated(data []byte) bool {
+	offset := 0
+
+	for len(data)-offset >= BoxHeaderSize {
+		size := int(binary.BigEndian.Uint32(data[offset:]))
+		if size < BoxHeaderSize || size > len(data)-offset {
+			return false
+		}
+		offset += size
+	}
+
+	return len(data)-offset == 4 && binary.BigEndian.Uint32(data[offset:]) == 0
+}
@@ -25,7 +25,14 @@ func DecodeCtts(r io.Reader) (Box, error) {
 		return nil, err
 	}
 
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
 	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*8 > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
 	b := &CttsBox{
 		Flags:        [3]byte{data[1], data[2], data[3]},
 		Version:      data[0],
@@ -67,3 +74,20 @@ func (b *CttsBox) Encode(w io.Writer) error {
 	_, err = w.Write(buf)
 	return err
 }
+
+// GetOffset returns the composition time offset of a sample (starting at 0), in time units.
+//
+// Offsets are signed in version 1.
+func (b *CttsBox) GetOffset(sample uint32) int64 {
+	for i := range b.SampleCount {
+		if sample < b.SampleCount[i] {
+			if b.Version == 1 {
+				return int64(int32(b.SampleOffset[i]))
+			}
+			return int64(b.SampleOffset[i])
+		}
+		sample -= b.SampleCount[i]
+	}
+
+	return 0
+}
@@ -0,0 +1,262 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// findBox returns the offset of the first box at boxPath (types separated by slashes) in a media, or -1
+func findBox(data []byte, boxPath string) int {
+	offset, end := 0, len(data)
+
+	for i, ht := range strings.Split(boxPath, "/") {
+		if i > 0 {
+			// The previous box is a container, its content follows its header
+			end = offset + int(binary.BigEndian.Uint32(data[offset:]))
+			offset += BoxHeaderSize
+		}
+
+		for {
+			if offset+BoxHeaderSize > end {
+				return -1
+			}
+			if string(data[offset+4:offset+8]) == ht {
+				break
+			}
+			offset += int(binary.BigEndian.Uint32(data[offset:]))
+		}
+	}
+
+	return offset
+}
+
+// TestDecodeInvalid decodes invalid medias, the errors locating the invalid boxes
+func TestDecodeInvalid(t *testing.T) {
+	files := testFiles(t)
+
+	const stbl = "moov/trak/mdia/minf/stbl"
+
+	tests := []struct {
+		name string
+		file string // the invalid media is a changed test media, reversed.mp4 by default
+		path string // the path of the invalid box
+		box  string // the box located by the error, when it isn't the invalid box
+		err  error
+
+		change func(data []byte, offset int) []byte
+	}{{
+		name: "truncated box",
+		path: stbl + "/stsz",
+		err:  ErrTruncatedBox,
+		change: func(data []byte, offset int) []byte {
+			return data[:offset+20]
+		},
+	}, {
+		name: "truncated header",
+		path: stbl + "/stsz",
+		box:  stbl,
+		err:  ErrTruncatedHeader,
+		change: func(data []byte, offset int) []byte {
+			return data[:offset+4]
+		},
+	}, {
+		name: "box larger than its container",
+		path: stbl + "/stsz",
+		err:  ErrInvalidBoxSize,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset:], uint32(len(data)))
+			return data
+		},
+	}, {
+		name: "track larger than the movie",
+		path: "moov/trak",
+		err:  ErrInvalidBoxSize,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset:], binary.BigEndian.Uint32(data[findBox(data, "moov"):]))
+			return data
+		},
+	}, {
+		name: "sample sizes overflow",
+		path: stbl + "/stsz",
+		err:  ErrInvalidBoxSize,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset+16:], 1<<28)
+			return data
+		},
+	}, {
+		name: "sample count overflow",
+		path: stbl + "/stsz",
+		box:  stbl,
+		err:  ErrInvalidSampleTable,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset+12:], 1)
+			binary.BigEndian.PutUint32(data[offset+16:], 1<<28)
+			return data
+		},
+	}, {
+		name: "time to sample overflow",
+		path: stbl + "/stts",
+		err:  ErrInvalidBoxSize,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset+12:], 1<<28)
+			return data
+		},
+	}, {
+		name: "user data larger than its container",
+		file: "interleaved.mp4",
+		path: "moov/udta/cprt",
+		err:  ErrInvalidBoxSize,
+		change: func(data []byte, offset int) []byte {
+			binary.BigEndian.PutUint32(data[offset:], 0x30)
+			return data
+		},
+	}, {
+		name: "missing movie header",
+		path: "moov/mvhd",
+		box:  "moov",
+		err:  ErrMissingBox,
+		change: func(data []byte, offset int) []byte {
+			copy(data[offset+4:], "free")
+			return data
+		},
+	}, {
+		name: "missing chunk offsets",
+		path: stbl + "/stco",
+		box:  stbl,
+		err:  ErrMissingBox,
+		change: func(data []byte, offset int) []byte {
+			copy(data[offset+4:], "free")
+			return data
+		},
+	}}
+
+	for _, tt := range tests {
+		if tt.file == "" {
+			tt.file = "reversed.mp4"
+		}
+
+		src := files[filepath.Join("testdata", tt.file)]
+		if src == nil {
+			t.Fatalf("%s: no test media %s", tt.name, tt.file)
+		}
+
+		offset := findBox(src, tt.path)
+		if offset < 0 {
+			t.Fatalf("%s: no %s box", tt.name, tt.path)
+		}
+
+		located := tt.path
+		if tt.box != "" {
+			located = tt.box
+		}
+
+		want := fmt.Sprintf("%s box at offset %d", located, findBox(src, located))
+		if tt.err == ErrTruncatedHeader {
+			// The header of the child is invalid, at its offset in its container
+			want = fmt.Sprintf("%s box at offset %d", located, offset)
+		}
+
+		data := tt.change(append([]byte{}, src...), offset)
+
+		_, err := DecodeSeeker(bytes.NewReader(data))
+
+		var de *DecodeError
+
+		switch {
+		case !errors.Is(err, tt.err):
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		case !errors.As(err, &de):
+			t.Errorf("%s: %v isn't a decode error", tt.name, err)
+		case !strings.Contains(err.Error(), want):
+			t.Errorf("%s: got error %q, want %q", tt.name, err, want)
+		case tt.err == ErrMissingBox && !strings.Contains(err.Error(), path.Base(tt.path)):
+			t.Errorf("%s: the error %q doesn't name the missing box", tt.name, err)
+		}
+	}
+}
+
+// TestDecodeValid decodes unusual but valid medias
+func TestDecodeValid(t *testing.T) {
+	files := testFiles(t)
+
+	// The user data of QuickTime medias may end with a 32 bits zero terminator
+	src := files[filepath.Join("testdata", "interleaved.mp4")]
+	if src == nil {
+		t.Fatal("no test media")
+	}
+
+	udta, moov := findBox(src, "moov/udta"), findBox(src, "moov")
+	end := udta + int(binary.BigEndian.Uint32(src[udta:]))
+
+	data := append(append(append([]byte{}, src[:end]...), 0, 0, 0, 0), src[end:]...)
+	binary.BigEndian.PutUint32(data[udta:], binary.BigEndian.Uint32(src[udta:])+4)
+	binary.BigEndian.PutUint32(data[moov:], binary.BigEndian.Uint32(src[moov:])+4)
+
+	m, err := DecodeSeeker(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+
+	if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), data) {
+		t.Fatal("the terminated user data isn't encoded as decoded", err)
+	}
+
+	// A track without sync sample table (all the samples are sync samples), and a track without sample
+	src = files[filepath.Join("testdata", "reversed.mp4")]
+	if src == nil {
+		t.Fatal("no test media")
+	}
+
+	if m, err = DecodeSeeker(bytes.NewReader(src)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, trak := range m.Moov.Trak {
+		stbl := trak.Mdia.Minf.Stbl
+		stbl.Stss = nil
+
+		if i > 0 {
+			stbl.Stts, stbl.Stsc, stbl.Stsz, stbl.Ctts = &SttsBox{}, &StscBox{}, NewStszBox(nil), nil
+			stbl.SetChunkOffsets(nil)
+		}
+	}
+
+	b.Reset()
+
+	if err = m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if m, err = DecodeSeeker(bytes.NewReader(b.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, trak := range m.Moov.Trak {
+		n, sync := 0, 0
+
+		it := m.Samples(trak)
+		for it.Next() {
+			n++
+			if it.Sample().IsSync {
+				sync++
+			}
+		}
+
+		switch {
+		case it.Err() != nil:
+			t.Fatalf("track %d: %v", i, it.Err())
+		case i > 0 && n != 0:
+			t.Fatalf("track %d: got %d samples, want none", i, n)
+		case i == 0 && (n == 0 || sync != n):
+			t.Fatalf("track %d: got %d sync samples out of %d", i, sync, n)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package stream
+
+import (
+	"io"
+	"time"
+)
+
+// A Demuxer reads the samples of the tracks of a media
+//
+// ReadHeader must be called first: it decodes the media from R and lists its tracks. TrackH264 and
+// TrackAAC are the first H.264 and AAC tracks, if any.
+//
+// The samples are read one track at a time with Track.ReadSample, or in decoding order over all the tracks
+// with ReadPacket. They are listed while reading, the sample tables aren't expanded in memory.
+//
+// Times are in the timescale of each track (see Track.TimeScale). Edit lists are not applied.
+type Demuxer struct {
+	R io.ReadSeeker
+
+	MP4    *MP4
+	Tracks []*Track
+
+	TrackH264 *Track
+	TrackAAC  *Track
+}
+
+// A track read by a Demuxer
+type Track struct {
+	Trak *TrakBox
+
+	m  *MP4
+	r  io.ReadSeeker
+	it *SampleIterator
+
+	// next is the next sample to read (when pending)
+	next    Sample
+	pending bool
+
+	// Computed by scan
+	scanned  bool
+	count    int
+	duration time.Duration
+}
+
+// ReadHeader decodes the media and lists its tracks
+func (d *Demuxer) ReadHeader() (err error) {
+	if d.MP4, err = DecodeSeeker(d.R); err != nil {
+		return
+	}
+
+	d.Tracks = make([]*Track, 0, len(d.MP4.Moov.Trak))
+
+	for _, t := range d.MP4.Moov.Trak {
+		if t.Mdia == nil || t.Mdia.Mdhd == nil || t.Mdia.Minf == nil || t.Mdia.Minf.Stbl == nil {
+			return ErrInvalidSampleTable
+		}
+
+		track := &Track{
+			Trak: t,
+			m:    d.MP4,
+			r:    d.R,
+		}
+
+		if err = track.rewind(); err != nil {
+			return
+		}
+
+		switch track.Format() {
+		case "avc1", "avc3":
+			if d.TrackH264 == nil {
+				d.TrackH264 = track
+			}
+		case "mp4a":
+			if d.TrackAAC == nil {
+				d.TrackAAC = track
+			}
+		}
+
+		d.Tracks = append(d.Tracks, track)
+	}
+
+	return
+}
+
+// ReadPacket reads the next sample of the media, in decoding order over all the tracks, and returns its
+// track. It returns io.EOF after the last sample.
+//
+// The position of each track is shared with Track.ReadSample and Track.SeekToTime.
+func (d *Demuxer) ReadPacket() (t *Track, pts, dts int64, isKeyFrame bool, data []byte, err error) {
+	var next time.Duration
+
+	for _, track := range d.Tracks {
+		if !track.pending {
+			continue
+		}
+		if ct := track.CurTime(); t == nil || ct < next {
+			t, next = track, ct
+		}
+	}
+
+	if t == nil {
+		for _, track := range d.Tracks {
+			if err = track.it.Err(); err != nil {
+				return nil, 0, 0, false, nil, err
+			}
+		}
+		return nil, 0, 0, false, nil, io.EOF
+	}
+
+	pts, dts, isKeyFrame, data, err = t.ReadSample()
+
+	return
+}
+
+// Kind returns the kind of the track (video, audio, ...)
+func (t *Track) Kind() TrackKind {
+	return t.Trak.Kind()
+}
+
+// Format returns the format of the first sample entry of the track (avc1, mp4a, ...), or an empty string
+func (t *Track) Format() string {
+	if stsd := t.Trak.Mdia.Minf.Stbl.Stsd; stsd != nil && len(stsd.Entries) > 0 {
+		return stsd.Entries[0].Type()
+	}
+	return ""
+}
+
+// TimeScale returns the number of time units per second of the track
+func (t *Track) TimeScale() uint32 {
+	return t.Trak.Mdia.Mdhd.Timescale
+}
+
+// SampleCount returns the number of samples of the track
+func (t *Track) SampleCount() int {
+	t.scan()
+	return t.count
+}
+
+// Samples returns an iterator over the samples of the track, from the first one
+func (t *Track) Samples() *SampleIterator {
+	return t.m.Samples(t.Trak)
+}
+
+// Duration returns the duration of the track, computed from its samples
+func (t *Track) Duration() time.Duration {
+	t.scan()
+	return t.duration
+}
+
+// scan lists the samples once, to count them and compute the duration of the track
+func (t *Track) scan() {
+	if t.scanned {
+		return
+	}
+
+	var first, end uint64
+
+	it := t.Samples()
+	for ; it.Next(); t.count++ {
+		s := it.Sample()
+		if t.count == 0 {
+			first = s.DTS
+		}
+		end = s.DTS + uint64(s.Duration)
+	}
+
+	if t.count > 0 {
+		t.duration = UnitsToDuration(end-first, t.TimeScale())
+	}
+
+	t.scanned = true
+}
+
+// CurTime returns the decoding time of the next sample to read
+func (t *Track) CurTime() time.Duration {
+	if !t.pending {
+		return t.Duration()
+	}
+	return UnitsToDuration(t.next.DTS, t.TimeScale())
+}
+
+// SeekToTime moves to the sync sample decoded at or before a time
+func (t *Track) SeekToTime(d time.Duration) error {
+	it := t.Samples()
+
+	if err := it.seekSync(DurationToUnits(d, t.TimeScale())); err != nil {
+		return err
+	}
+
+	t.it = it
+	t.advance()
+
+	return t.it.Err()
+}
+
+// rewind moves to the first sample
+func (t *Track) rewind() error {
+	t.it = t.Samples()
+	t.advance()
+	return t.it.Err()
+}
+
+// advance moves to the next sample
+func (t *Track) advance() {
+	t.pending = t.it.Next()
+	t.next = t.it.Sample()
+}
+
+// ReadSample reads the next sample. It returns io.EOF after the last sample.
+func (t *Track) ReadSample() (pts, dts int64, isKeyFrame bool, data []byte, err error) {
+	if !t.pending {
+		if err = t.it.Err(); err == nil {
+			err = io.EOF
+		}
+		return
+	}
+
+	s := t.next
+
+	if _, err = t.r.Seek(s.Offset, io.SeekStart); err != nil {
+		return
+	}
+
+	if data, err = readFull(t.r, int64(s.Size)); err != nil {
+		return
+	}
+
+	t.advance()
+
+	return s.PTS, int64(s.DTS), s.IsSync, data, nil
+}
+
+// GetH264SPS returns the first sequence parameter set of a H.264 track, or nil
+func (t *Track) GetH264SPS() []byte {
+	sps, _ := t.h264ParameterSets()
+	return sps
+}
+
+// GetH264PPS returns the first picture parameter set of a H.264 track, or nil
+func (t *Track) GetH264PPS() []byte {
+	_, pps := t.h264ParameterSets()
+	return pps
+}
+
+// h264ParameterSets returns the first SPS and PPS of the avcC box (AVCDecoderConfigurationRecord)
+func (t *Track) h264ParameterSets() (sps, pps []byte) {
+	stsd := t.Trak.Mdia.Minf.Stbl.Stsd
+	if stsd == nil || len(stsd.Entries) == 0 {
+		return
+	}
+
+	e, ok := stsd.Entries[0].(*VisualSampleEntry)
+	if !ok {
+		return
+	}
+
+	avcC, ok := e.Box("avcC").(*UniBox)
+	if !ok || len(avcC.buff) < 6 {
+		return
+	}
+
+	data := avcC.buff[5:]
+
+	// numOfSequenceParameterSets, then numOfPictureParameterSets, each set prefixed by its length
+	for _, ps := range []*[]byte{&sps, &pps} {
+		n := int(data[0])
+		data = data[1:]
+		if ps == &sps {
+			n &= 0x1f
+		}
+		for i := 0; i < n; i++ {
+			if len(data) < 2 {
+				return
+			}
+			l := int(data[0])<<8 | int(data[1])
+			if len(data) < 2+l {
+				return
+			}
+			if i == 0 {
+				*ps = data[2 : 2+l]
+			}
+			data = data[2+l:]
+		}
+		if len(data) == 0 {
+			return
+		}
+	}
+
+	return
+}
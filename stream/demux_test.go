@@ -0,0 +1,109 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// untimedFragments returns a copy of a fragmented media whose track fragments have no decode time, the tfdt
+// boxes being renamed free
+func untimedFragments(src []byte) []byte {
+	b := append([]byte(nil), src...)
+	for i := bytes.Index(b, []byte("tfdt")); i >= 0; i = bytes.Index(b, []byte("tfdt")) {
+		copy(b[i:], "free")
+	}
+	return b
+}
+
+// TestDemuxer reads the packets of the test medias, and checks that they come in decoding order
+func TestDemuxer(t *testing.T) {
+	for name, src := range testFiles(t) {
+		d := &Demuxer{R: bytes.NewReader(src)}
+		if err := d.ReadHeader(); err != nil {
+			t.Fatal(name, err)
+		}
+
+		if d.TrackH264 == nil || d.TrackAAC == nil {
+			t.Fatalf("%s: no H.264 or AAC track", name)
+		}
+
+		var last time.Duration
+
+		count := map[*Track]int{}
+
+		for {
+			track, _, dts, _, data, err := d.ReadPacket()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(name, err)
+			}
+
+			ct := UnitsToDuration(uint64(dts), track.TimeScale())
+			if ct < last || len(data) == 0 {
+				t.Fatalf("%s: packet %d of track %d out of order", name, count[track], track.Trak.Tkhd.TrackId)
+			}
+
+			last = ct
+			count[track]++
+		}
+
+		for _, track := range d.Tracks {
+			if count[track] != track.SampleCount() {
+				t.Fatalf("%s: read %d samples of track %d, want %d", name, count[track], track.Trak.Tkhd.TrackId, track.SampleCount())
+			}
+		}
+	}
+}
+
+// TestSeekToTime compares the samples read after seeking with the last sync samples decoded at or before
+// the times, found listing the samples
+func TestSeekToTime(t *testing.T) {
+	files := testFiles(t)
+	files["untimed fragments"] = untimedFragments(files[filepath.Join("testdata", "fragmented.mp4")])
+
+	for name, src := range files {
+		d := &Demuxer{R: bytes.NewReader(src)}
+		if err := d.ReadHeader(); err != nil {
+			t.Fatal(name, err)
+		}
+
+		for _, track := range d.Tracks {
+			var samples []Sample
+
+			it := track.Samples()
+			for it.Next() {
+				samples = append(samples, it.Sample())
+			}
+
+			end := track.Duration() + time.Second
+
+			for at := -time.Second / 2; at < end; at += 37 * time.Millisecond {
+				want := samples[0]
+
+				units := DurationToUnits(at, track.TimeScale())
+				for _, s := range samples {
+					if s.DTS > units {
+						break
+					}
+					if s.IsSync {
+						want = s
+					}
+				}
+
+				if err := track.SeekToTime(at); err != nil {
+					t.Fatal(name, err)
+				}
+
+				pts, dts, sync, _, err := track.ReadSample()
+				if err != nil || pts != want.PTS || uint64(dts) != want.DTS || sync != want.IsSync {
+					t.Fatalf("%s: track %d: seeking to %v, got sample at %d, want %d (%v)", name, track.Trak.Tkhd.TrackId, at, dts, want.DTS, err)
+				}
+			}
+		}
+	}
+}
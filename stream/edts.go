@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"io"
+)
+
+// Edit Box (edts - optional)
+//
+// Contained in : Track Box (trak)
+//
+// Status: decoded
+//
+// Contains the edit list (elst) of the track.
+type EdtsBox struct {
+	Elst  *ElstBox
+	boxes []Box
+	order []Box
+}
+
+func DecodeEdts(r io.Reader) (Box, error) {
+	l, err := DecodeContainer(r)
+	if err != nil {
+		return nil, err
+	}
+	e := &EdtsBox{}
+	e.SetChildren(l)
+	return e, nil
+}
+
+func (b *EdtsBox) Type() string {
+	return "edts"
+}
+
+func (b *EdtsBox) Size() int {
+	return boxSize(boxesSize(b.children()))
+}
+
+func (b *EdtsBox) Dump() {
+	if b.Elst != nil {
+		b.Elst.Dump()
+	}
+}
+
+func (b *EdtsBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *EdtsBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *EdtsBox) SetChildren(l []Box) {
+	b.Elst, b.boxes = nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *ElstBox:
+			if b.Elst == nil {
+				b.Elst = c
+				continue
+			}
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *EdtsBox) children() []Box {
+	var l []Box
+	if b.Elst != nil {
+		l = append(l, b.Elst)
+	}
+	l = append(l, b.boxes...)
+	return l
+}
@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+// Edit List Box (elst - optional)
+//
+// Contained in : Edit Box (edts)
+//
+// Status: decoded
+//
+// The edit list maps the media timeline to the presentation timeline. Each entry is defined by :
+//
+//   * segment duration : duration of the edit, in movie time units (see the movie header box - mvhd)
+//   * media time : start of the edit, in media time units (see the media header box - mdhd). -1 is an empty edit
+//   * media rate : playback rate of the edit (16 bits integer + 16 bits fraction). 0 is a dwell
+//
+// Version 0 stores durations and times on 32 bits, version 1 on 64 bits. Version 1 is encoded when
+// Version is 1 or when a value doesn't fit in 32 bits.
+type ElstBox struct {
+	Version byte
+	Flags   [3]byte
+	header  [8]byte
+	Entries []ElstEntry
+}
+
+// An edit list entry
+type ElstEntry struct {
+	SegmentDuration   uint64
+	MediaTime         int64
+	MediaRateInteger  int16
+	MediaRateFraction int16
+}
+
+func DecodeElst(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
+	c := binary.BigEndian.Uint32(data[4:8])
+	n := uint64(12)
+	if data[0] == 1 {
+		n = 20
+	}
+	if uint64(c)*n > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
+
+	b := &ElstBox{
+		Flags:   [3]byte{data[1], data[2], data[3]},
+		Version: data[0],
+		Entries: make([]ElstEntry, c),
+	}
+
+	for i, n := 0, 8; i < int(c); i++ {
+		e := &b.Entries[i]
+		if b.Version == 1 {
+			e.SegmentDuration = binary.BigEndian.Uint64(data[n : n+8])
+			e.MediaTime = int64(binary.BigEndian.Uint64(data[n+8 : n+16]))
+			n += 16
+		} else {
+			e.SegmentDuration = uint64(binary.BigEndian.Uint32(data[n : n+4]))
+			e.MediaTime = int64(int32(binary.BigEndian.Uint32(data[n+4 : n+8])))
+			n += 8
+		}
+		e.MediaRateInteger = int16(binary.BigEndian.Uint16(data[n : n+2]))
+		e.MediaRateFraction = int16(binary.BigEndian.Uint16(data[n+2 : n+4]))
+		n += 4
+	}
+
+	return b, nil
+}
+
+func (b *ElstBox) Type() string {
+	return "elst"
+}
+
+func (b *ElstBox) version() byte {
+	if b.Version == 1 {
+		return 1
+	}
+	for _, e := range b.Entries {
+		if e.SegmentDuration > math.MaxUint32 || e.MediaTime > math.MaxInt32 || e.MediaTime < math.MinInt32 {
+			return 1
+		}
+	}
+	return 0
+}
+
+func (b *ElstBox) Size() int {
+	if b.version() == 1 {
+		return BoxHeaderSize + 8 + len(b.Entries)*20
+	}
+	return BoxHeaderSize + 8 + len(b.Entries)*12
+}
+
+func (b *ElstBox) Dump() {
+	fmt.Println("Edit list:")
+	for i, e := range b.Entries {
+		fmt.Printf(" #%d : %d units from media time %d at rate %d.%d\n", i, e.SegmentDuration, e.MediaTime, e.MediaRateInteger, e.MediaRateFraction)
+	}
+}
+
+func (b *ElstBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.version()
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(b.Entries)))
+	n := 8
+	for _, e := range b.Entries {
+		if buf[0] == 1 {
+			binary.BigEndian.PutUint64(buf[n:], e.SegmentDuration)
+			binary.BigEndian.PutUint64(buf[n+8:], uint64(e.MediaTime))
+			n += 16
+		} else {
+			binary.BigEndian.PutUint32(buf[n:], uint32(e.SegmentDuration))
+			binary.BigEndian.PutUint32(buf[n+4:], uint32(int32(e.MediaTime)))
+			n += 8
+		}
+		binary.BigEndian.PutUint16(buf[n:], uint16(e.MediaRateInteger))
+		binary.BigEndian.PutUint16(buf[n+2:], uint16(e.MediaRateFraction))
+		n += 4
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// rate returns the media rate as a 16.16 fixed point number
+func (e *ElstEntry) rate() int64 {
+	return int64(e.MediaRateInteger)<<16 | int64(uint16(e.MediaRateFraction))
+}
+
+// PresentationTime maps a media time (in media time units) to the presentation timeline.
+//
+// movieTimescale (mvhd) is the timescale of segment durations, mediaTimescale (mdhd) the timescale of media times.
+// ok is false when the media time is not part of any edit (not presented).
+// A segment duration of 0 on the last edit extends it up to the end of the media.
+func (b *ElstBox) PresentationTime(mediaTime int64, movieTimescale, mediaTimescale uint32) (d time.Duration, ok bool) {
+	var start uint64
+
+	for i, e := range b.Entries {
+		last := i == len(b.Entries)-1
+
+		if e.MediaTime >= 0 && mediaTime >= e.MediaTime {
+			rate := e.rate()
+
+			if rate == 0 {
+				// dwell : a single media time is presented for the whole segment
+				if mediaTime == e.MediaTime {
+					return UnitsToDuration(start, movieTimescale), true
+				}
+			} else {
+				// media duration of the segment = segment duration * rate, in media units
+				span := new(big.Int).SetUint64(e.SegmentDuration)
+				span.Mul(span, big.NewInt(int64(mediaTimescale)*rate))
+				span.Quo(span, big.NewInt(int64(movieTimescale)<<16))
+
+				if (last && e.SegmentDuration == 0) || big.NewInt(mediaTime-e.MediaTime).Cmp(span) < 0 {
+					offset := (mediaTime - e.MediaTime) << 16 / rate
+					return UnitsToDuration(start, movieTimescale) + UnitsToDuration(uint64(offset), mediaTimescale), true
+				}
+			}
+		}
+
+		start += e.SegmentDuration
+	}
+
+	return 0, false
+}
+
+// MediaTime maps a presentation time to the media timeline (in media time units), the reverse of PresentationTime.
+//
+// ok is false when no media is presented at that time (empty edit, or after the last edit).
+func (b *ElstBox) MediaTime(d time.Duration, movieTimescale, mediaTimescale uint32) (mediaTime int64, ok bool) {
+	var start uint64
+
+	for i, e := range b.Entries {
+		last := i == len(b.Entries)-1
+		end := start + e.SegmentDuration
+		from := UnitsToDuration(start, movieTimescale)
+
+		if d >= from && (d < UnitsToDuration(end, movieTimescale) || (last && e.SegmentDuration == 0)) {
+			if e.MediaTime < 0 {
+				return 0, false
+			}
+
+			rate := e.rate()
+			offset := int64(DurationToUnits(d-from, mediaTimescale))
+
+			if rate != 1<<16 {
+				offset = offset * rate >> 16
+			}
+
+			return e.MediaTime + offset, true
+		}
+
+		start = end
+	}
+
+	return 0, false
+}
@@ -2,11 +2,8 @@ package filter
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"io"
-	"os"
-	"syscall"
 	"time"
 
 	"github.com/seifer/go-mp4/stream"
@@ -16,14 +13,10 @@ var (
 	ErrClipOutside     = errors.New("clip zone is outside video")
 	ErrTruncatedChunk  = errors.New("chunk was truncated")
 	ErrInvalidDuration = errors.New("invalid duration")
+	ErrFragmented      = errors.New("fragmented media is not supported")
+	ErrMissingBox      = stream.ErrMissingBox
 )
 
-type chunk struct {
-	size      int64
-	oldOffset int64
-	newOffset int64
-}
-
 type trakInfo struct {
 	rebuilded bool
 
@@ -31,40 +24,73 @@ type trakInfo struct {
 	currentChunk int
 
 	index         uint32
+	chunkSample   uint32
 	currentSample uint32
 	firstSample   uint32
+	lastSample    uint32
+
+	mediaBegin int64
+	delay      time.Duration
 }
 
 type clipFilter struct {
-	firstChunk   int
-	bufferLength int
+	chunkReader
 
-	size    int64
-	offset  int64
-	forskip int64
+	m *stream.MP4
 
-	buffer []byte
-	chunks []chunk
+	end     time.Duration
+	begin   time.Duration
+	precise bool
 
-	m      *stream.MP4
-	reader io.Reader
+	result ClipResult
+}
 
-	end   time.Duration
-	begin time.Duration
+// ClipResult is the time range actually extracted by a clip filter. It may differ from the requested
+// one, as a clip begins on a key frame and samples are kept whole.
+type ClipResult struct {
+	Begin time.Duration
+	End   time.Duration
 }
 
-type ClipInterface interface {
+// FilterInterface is a filtered media: Filter prepares it, then it is read as a file
+type FilterInterface interface {
 	io.ReadSeeker
 
 	Filter() error
 	WriteTo(io.Writer) (n int64, err error)
 }
 
-// Clip returns a filter that extracts a clip between begin and begin + duration (in seconds, starting at 0)
+type ClipInterface interface {
+	FilterInterface
+
+	// Result returns the time range of the clip, once filtered
+	Result() ClipResult
+}
+
+// Clip returns a filter that extracts a clip between begin and begin + duration (starting at 0)
 // Il will try to include a key frame at the beginning, and keeps the same chunks as the origin media
+// (the first and last chunks of each track being cut to the clip)
 func Clip(m *stream.MP4, begin, duration time.Duration) (ClipInterface, error) {
+	return newClip(m, begin, duration, false)
+}
+
+// ClipPrecise returns a filter that extracts a clip starting exactly at begin: the samples from the
+// preceding key frame are kept, and an edit list on each track starts the playback at begin
+func ClipPrecise(m *stream.MP4, begin, duration time.Duration) (ClipInterface, error) {
+	return newClip(m, begin, duration, true)
+}
+
+func newClip(m *stream.MP4, begin, duration time.Duration, precise bool) (ClipInterface, error) {
 	end := begin + duration
 
+	if m.Mdat == nil || len(m.Fragments) > 0 {
+		return nil, ErrFragmented
+	}
+
+	if err := checkTracks(m); err != nil {
+		return nil, err
+	}
+
 	if begin < 0 {
 		return nil, ErrClipOutside
 	}
@@ -82,115 +108,42 @@ func Clip(m *stream.MP4, begin, duration time.Duration) (ClipInterface, error) {
 	}
 
 	return &clipFilter{
-		m:     m,
-		end:   end,
-		begin: begin,
+		m:       m,
+		end:     end,
+		begin:   begin,
+		precise: precise,
 	}, nil
 }
 
-func (f *clipFilter) Seek(offset int64, whence int) (int64, error) {
-	noffset := f.offset
-
-	if whence == os.SEEK_END {
-		noffset = f.size + offset
-	} else if whence == os.SEEK_SET {
-		noffset = offset
-	} else if whence == os.SEEK_CUR {
-		noffset += offset
-	} else {
-		return -1, syscall.EINVAL
-	}
-
-	if noffset < 0 {
-		return -1, syscall.EINVAL
-	}
-
-	if noffset > f.size {
-		return -1, syscall.EINVAL
-	}
-
-	f.offset = noffset
-
-	return noffset, nil
-}
-
-func (f *clipFilter) Read(buf []byte) (n int, err error) {
-	var nn int
-
-	if len(buf) == 0 {
-		return
-	}
-
-	if int(f.offset) < f.bufferLength && len(buf) > 0 {
-		nn := copy(buf, f.buffer[f.offset:])
-		f.offset += int64(nn)
-		n += nn
-		buf = buf[nn:]
-
-		if int(f.offset) >= f.bufferLength {
-			f.buffer = nil
-		}
-	}
-
-	s, seekable := f.reader.(io.ReadSeeker)
-
-	for f.firstChunk < len(f.chunks) && err == nil && len(buf) > 0 {
-		c := f.chunks[f.firstChunk]
+func (f *clipFilter) Filter() (err error) {
+	f.buildChunkList()
 
-		if f.offset >= c.newOffset+c.size {
-			f.firstChunk++
-			continue
-		}
+	// Update chunk offset
+	stream.RelocateChunks(f.m.Moov, func(moovSize int) uint64 {
+		bsz := uint64(f.m.Mdat.HeaderSize())
+		bsz += uint64(moovSize)
 
-		realOffset := c.oldOffset + (f.offset - c.newOffset)
-		if seekable {
-			if _, err = s.Seek(realOffset, os.SEEK_SET); err != nil {
-				return
-			}
+		if f.m.Ftyp != nil {
+			bsz += uint64(f.m.Ftyp.Size())
 		}
 
-		can := int(c.size - (f.offset - c.newOffset))
-
-		if can > len(buf) {
-			can = len(buf)
+		for _, b := range f.m.Boxes() {
+			bsz += uint64(b.Size())
 		}
 
-		nn, err = io.ReadFull(f.reader, buf[:can])
-		f.offset += int64(nn)
-		n += nn
-		buf = buf[nn:]
+		return bsz
+	})
 
-		if nn != can {
-			if err == nil {
-				err = ErrTruncatedChunk
-			}
-		}
-	}
-
-	return
-}
-
-func (f *clipFilter) Filter() (err error) {
-	f.buildChunkList()
-
-	bsz := uint32(stream.BoxHeaderSize)
-	bsz += uint32(f.m.Moov.Size())
-
-	for _, b := range f.m.Boxes() {
-		bsz += uint32(b.Size())
-	}
+	// Prepare blob with ftyp, moov and other small atoms
+	buffer := make([]byte, 0)
+	Buffer := bytes.NewBuffer(buffer)
 
-	// Update chunk offset
-	for _, t := range f.m.Moov.Trak {
-		for i, _ := range t.Mdia.Minf.Stbl.Stco.ChunkOffset {
-			t.Mdia.Minf.Stbl.Stco.ChunkOffset[i] += bsz
+	if f.m.Ftyp != nil {
+		if err = f.m.Ftyp.Encode(Buffer); err != nil {
+			return
 		}
 	}
 
-	// Prepare blob with moov and other small atoms
-	buffer := make([]byte, 0)
-	Buffer := bytes.NewBuffer(buffer)
-
 	if err = f.m.Moov.Encode(Buffer); err != nil {
 		return
 	}
@@ -201,157 +154,34 @@ func (f *clipFilter) Filter() (err error) {
 		}
 	}
 
-	buf := make([]byte, stream.BoxHeaderSize)
-	binary.BigEndian.PutUint32(buf, uint32(f.m.Mdat.Size()))
-	copy(buf[4:], f.m.Mdat.Type())
-
-	if _, err = Buffer.Write(buf); err != nil {
+	if err = f.m.Mdat.EncodeHeader(Buffer); err != nil {
 		return
 	}
 
+	header := Buffer.Bytes()
+
 	f.size = int64(f.m.Size())
-	f.buffer = Buffer.Bytes()
 	f.reader = f.m.Mdat.Reader()
-	f.bufferLength = len(f.buffer)
 
-	if len(f.chunks) > 0 {
-		f.compactChunks()
-	}
+	f.compactChunks(int64(len(header)))
+	f.chunks = append([]chunk{{size: int64(len(header)), data: header}}, f.chunks...)
 
 	f.m = nil
 
 	return
 }
 
-func (f *clipFilter) WriteTo(w io.Writer) (n int64, err error) {
-	var nn int
-	var nnn int64
-
-	if nn, err = w.Write(f.buffer); err != nil {
-		return
-	}
-
-	n += int64(nn)
-	s, seekable := f.reader.(io.Seeker)
-
-	for _, c := range f.chunks {
-		csize := int64(c.size)
-
-		if seekable {
-			if _, err = s.Seek(int64(c.oldOffset), os.SEEK_SET); err != nil {
-				return
-			}
-		}
-
-		nnn, err = io.CopyN(w, f.reader, csize)
-		n += nnn
-		if err != nil {
-			return
-		}
-
-		if nnn != csize {
-			if err == nil {
-				err = ErrTruncatedChunk
-			}
-		}
-
-		if err != nil {
-			return
-		}
-	}
-
-	return
-}
-
-func (f *clipFilter) WriteToN(dst io.Writer, size int64) (n int64, err error) {
-	var nn int
-	var nnn int64
-
-	if size == 0 {
-		return
-	}
-
-	for int(f.offset) < f.bufferLength && err == nil && n < size {
-		can := int64(f.bufferLength - int(f.offset))
-
-		if can > size {
-			can = size
-		}
-
-		nn, err = dst.Write(f.buffer[f.offset : f.offset+can])
-		f.offset += int64(nn)
-		n += int64(nn)
-
-		if int(f.offset) == f.bufferLength {
-			f.buffer = nil
-		}
-	}
-
-	s, seekable := f.reader.(io.ReadSeeker)
-
-	for f.firstChunk < len(f.chunks) && err == nil && n < size {
-		c := f.chunks[f.firstChunk]
-
-		if f.offset >= c.newOffset+c.size {
-			f.firstChunk++
-			continue
-		}
-
-		realOffset := c.oldOffset + (f.offset - c.newOffset)
-
-		if seekable {
-			if _, err = s.Seek(realOffset, os.SEEK_SET); err != nil {
-				return
-			}
-		}
-
-		can := c.size - (f.offset - c.newOffset)
-
-		if can > size-n {
-			can = size - n
-		}
-
-		nnn, err = io.CopyN(dst, f.reader, can)
-		f.offset += nnn
-		n += nnn
-
-		if nnn != can {
-			if err == nil {
-				err = ErrTruncatedChunk
-			}
-		}
-	}
-
-	return
-}
-
-func (f *clipFilter) compactChunks() {
-	newChunks := make([]chunk, 0, 4)
-	last := f.chunks[0]
-	last.newOffset = int64(f.bufferLength)
-	lastBound := last.oldOffset + last.size
-	for i := 1; i < len(f.chunks); i++ {
-		ch := f.chunks[i]
-		if lastBound == ch.oldOffset {
-			lastBound += ch.size
-			last.size += ch.size
-		} else {
-			newChunks = append(newChunks, last)
-			ch.newOffset = last.newOffset + last.size
-			last = ch
-			lastBound = ch.oldOffset + ch.size
-		}
-	}
-	newChunks = append(newChunks, last)
-	f.chunks = newChunks
+func (f *clipFilter) Result() ClipResult {
+	return f.result
 }
 
 func (f *clipFilter) buildChunkList() {
 	var sz, mt int
-	var mv, off, size, sample, current, descriptionID, chunkFirstSample uint32
+	var mv, off, duration uint64
+	var size, descriptionID uint32
 
 	for _, t := range f.m.Moov.Trak {
-		sz += len(t.Mdia.Minf.Stbl.Stco.ChunkOffset)
+		sz += t.Mdia.Minf.Stbl.ChunkCount()
 	}
 
 	f.m.Mdat.ContentSize = 0
@@ -362,7 +192,7 @@ func (f *clipFilter) buildChunkList() {
 	ti := make([]trakInfo, cnt, cnt)
 
 	newFirstChunk := make([][]uint32, cnt, cnt)
-	newChunkOffset := make([][]uint32, cnt, cnt)
+	newChunkOffset := make([][]uint64, cnt, cnt)
 	newSamplesPerChunk := make([][]uint32, cnt, cnt)
 	newSampleDescriptionID := make([][]uint32, cnt, cnt)
 
@@ -372,60 +202,69 @@ func (f *clipFilter) buildChunkList() {
 	// Correct filters (begin, end) timecode
 	for tnum, t := range f.m.Moov.Trak {
 		newFirstChunk[tnum] = make([]uint32, 0, len(t.Mdia.Minf.Stbl.Stsc.FirstChunk))
-		newChunkOffset[tnum] = make([]uint32, 0, len(t.Mdia.Minf.Stbl.Stco.ChunkOffset))
+		newChunkOffset[tnum] = make([]uint64, 0, t.Mdia.Minf.Stbl.ChunkCount())
 		newSamplesPerChunk[tnum] = make([]uint32, 0, len(t.Mdia.Minf.Stbl.Stsc.SamplesPerChunk))
 		newSampleDescriptionID[tnum] = make([]uint32, 0, len(t.Mdia.Minf.Stbl.Stsc.SampleDescriptionID))
 
-		// Find stss. Video trak
-		if stss := t.Mdia.Minf.Stbl.Stss; stss != nil {
+		// Video trak, begin on a key frame (all samples are key frames without stss)
+		if stss := t.Mdia.Minf.Stbl.Stss; !f.precise && t.Kind() == stream.TrackVideo && stss != nil {
 			stts := t.Mdia.Minf.Stbl.Stts
 
 			// Find sample number current begin timecode
-			fs := stts.GetSample(uint32(f.begin.Seconds()) * t.Mdia.Mdhd.Timescale)
+			fs := stts.GetSample(stream.DurationToUnits(f.begin, t.Mdia.Mdhd.Timescale))
 
 			// Find timecode for closest l-frame
-			tc := stts.GetTimeCode(stss.GetClosestSample(fs))
+			tc := stts.GetTimeCode(stss.GetClosestSample(fs) - 1)
 
 			// Rebuild begin timecode
-			f.begin = time.Second * time.Duration(tc) / time.Duration(t.Mdia.Mdhd.Timescale)
+			f.begin = stream.UnitsToDuration(tc, t.Mdia.Mdhd.Timescale)
 		}
 	}
 
-	f.m.Moov.Mvhd.Duration = uint32((f.end - f.begin).Seconds()) * f.m.Moov.Mvhd.Timescale
-
 	// Skip excess chunks
 	for tnum, t := range f.m.Moov.Trak {
 		cti := &ti[tnum]
 
-		stco := t.Mdia.Minf.Stbl.Stco
+		stbl := t.Mdia.Minf.Stbl
 		stsc := t.Mdia.Minf.Stbl.Stsc
+		timescale := t.Mdia.Mdhd.Timescale
+
+		cti.mediaBegin, cti.delay = f.mediaBegin(t)
+
+		firstSample := stbl.Stts.GetSample(stream.DurationToUnits(f.begin, timescale))
+		mediaEnd := int64(stream.DurationToUnits(f.end, timescale))
+
+		if f.precise {
+			firstSample = syncSampleBefore(t, cti.mediaBegin)
+			mediaEnd = cti.mediaBegin + int64(stream.DurationToUnits(f.end-f.begin-cti.delay, timescale))
+		}
+
+		lastSample, found := lastSampleBefore(t, mediaEnd)
+		found = found && lastSample >= firstSample
 
-		firstSample := t.Mdia.Minf.Stbl.Stts.GetSample(uint32(f.begin.Seconds()) * t.Mdia.Mdhd.Timescale)
-		lastSample := t.Mdia.Minf.Stbl.Stts.GetSample(uint32(f.end.Seconds()) * t.Mdia.Mdhd.Timescale)
+		cti.lastSample = lastSample
+		cti.firstSample = firstSample
+		cti.currentSample = firstSample
 
-		for i, _ := range stco.ChunkOffset {
+		for i := 0; found && i < stbl.ChunkCount(); i++ {
 			if cti.sci < len(stsc.FirstChunk)-1 && i+1 >= int(stsc.FirstChunk[cti.sci+1]) {
 				cti.sci++
 			}
 
-			chunkFirstSample = cti.currentSample
-			cti.currentSample += stsc.SamplesPerChunk[cti.sci]
-
-			if cti.currentSample-1 < firstSample || chunkFirstSample > lastSample {
-				continue
+			if cti.chunkSample+stsc.SamplesPerChunk[cti.sci] > firstSample {
+				cti.currentChunk = i
+				break
 			}
 
-			cti.currentChunk = i
-
-			cti.firstSample = chunkFirstSample
-			cti.currentSample = chunkFirstSample
-
-			break
+			cti.chunkSample += stsc.SamplesPerChunk[cti.sci]
 		}
 
-		if cti.currentChunk == len(stco.ChunkOffset)-1 {
+		// Nothing to keep from this track
+		if !found {
 			cnt--
 			cti.rebuilded = true
+			cti.firstSample = 0
+			cti.currentSample = 0
 		}
 	}
 
@@ -437,9 +276,9 @@ func (f *clipFilter) buildChunkList() {
 				continue
 			}
 
-			if mv == 0 || t.Mdia.Minf.Stbl.Stco.ChunkOffset[ti[tnum].currentChunk] < mv {
+			if o := t.Mdia.Minf.Stbl.ChunkOffset(ti[tnum].currentChunk); mv == 0 || o < mv {
 				mt = tnum
-				mv = t.Mdia.Minf.Stbl.Stco.ChunkOffset[ti[tnum].currentChunk]
+				mv = o
 			}
 		}
 
@@ -453,9 +292,19 @@ func (f *clipFilter) buildChunkList() {
 			cti.sci++
 		}
 
-		samples := stsc.SamplesPerChunk[cti.sci]
+		chunkSamples := stsc.SamplesPerChunk[cti.sci]
 		descriptionID = stsc.SampleDescriptionID[cti.sci]
 
+		// The first and last chunks may be cut: skip the samples before the clip
+		for s := cti.chunkSample; s < cti.currentSample; s++ {
+			mv += uint64(stsz.GetSampleSize(int(s)))
+		}
+
+		samples := cti.chunkSample + chunkSamples - cti.currentSample
+		if cti.currentSample+samples > cti.lastSample+1 {
+			samples = cti.lastSample + 1 - cti.currentSample
+		}
+
 		size = 0
 
 		for i := 0; i < int(samples); i++ {
@@ -463,8 +312,8 @@ func (f *clipFilter) buildChunkList() {
 			cti.currentSample++
 		}
 
-		off += size
-		f.m.Mdat.ContentSize += size
+		off += uint64(size)
+		f.m.Mdat.ContentSize += uint64(size)
 
 		f.chunks = append(f.chunks, chunk{
 			size:      int64(size),
@@ -483,8 +332,9 @@ func (f *clipFilter) buildChunkList() {
 
 		// Go in next chunk
 		cti.currentChunk++
+		cti.chunkSample += chunkSamples
 
-		if cti.currentChunk == len(f.m.Moov.Trak[mt].Mdia.Minf.Stbl.Stco.ChunkOffset) {
+		if cti.currentChunk == f.m.Moov.Trak[mt].Mdia.Minf.Stbl.ChunkCount() || cti.currentSample > cti.lastSample {
 			cnt--
 			cti.rebuilded = true
 		}
@@ -496,41 +346,25 @@ func (f *clipFilter) buildChunkList() {
 		start := stts.GetTimeCode(cti.firstSample)
 		end := stts.GetTimeCode(cti.currentSample)
 
-		t.Tkhd.Duration = ((end - start) / t.Mdia.Mdhd.Timescale) * f.m.Moov.Mvhd.Timescale
+		t.Tkhd.Duration = stream.RescaleUnits(end-start, t.Mdia.Mdhd.Timescale, f.m.Moov.Mvhd.Timescale)
 		t.Mdia.Mdhd.Duration = end - start
 
-		// stts - sample duration
-		if stts := t.Mdia.Minf.Stbl.Stts; stts != nil {
-			sample = 0
-			current = 0
+		// edts - present the track from the clip beginning
+		if f.precise || t.Edts != nil {
+			f.editTrak(t, cti, start)
+		}
 
-			firstSample := cti.firstSample
-			currentSample := cti.currentSample
+		if t.Tkhd.Duration > duration {
+			duration = t.Tkhd.Duration
+		}
 
-			oldSampleCount := stts.SampleCount
-			oldSampleTimeDelta := stts.SampleTimeDelta
-
-			newSampleCount := make([]uint32, 0, len(oldSampleCount))
-			newSampleTimeDelta := make([]uint32, 0, len(oldSampleTimeDelta))
-
-			for i := 0; i < len(oldSampleCount) && sample < currentSample; i++ {
-				if sample+oldSampleCount[i] >= firstSample {
-					switch {
-					case sample <= firstSample && sample+oldSampleCount[i] > currentSample:
-						current = currentSample - firstSample + 1
-					case sample < firstSample:
-						current = oldSampleCount[i] + sample - firstSample
-					case sample+oldSampleCount[i] > currentSample:
-						current = oldSampleCount[i] + sample - currentSample
-					default:
-						current = oldSampleCount[i]
-					}
-
-					newSampleCount = append(newSampleCount, current)
-					newSampleTimeDelta = append(newSampleTimeDelta, oldSampleTimeDelta[i])
-				}
+		// stts - sample duration
+		if stts := t.Mdia.Minf.Stbl.Stts; stts != nil {
+			newSampleCount, runs := cutRuns(stts.SampleCount, cti.firstSample, cti.currentSample)
+			newSampleTimeDelta := make([]uint32, 0, len(runs))
 
-				sample += oldSampleCount[i]
+			for _, i := range runs {
+				newSampleTimeDelta = append(newSampleTimeDelta, stts.SampleTimeDelta[i])
 			}
 
 			stts.SampleCount = newSampleCount
@@ -546,7 +380,7 @@ func (f *clipFilter) buildChunkList() {
 			newSampleNumber := make([]uint32, 0, len(oldSampleNumber))
 
 			for _, n := range oldSampleNumber {
-				if n >= firstSample && n <= currentSample {
+				if n > firstSample && n <= currentSample {
 					newSampleNumber = append(newSampleNumber, n-firstSample)
 				}
 			}
@@ -562,45 +396,227 @@ func (f *clipFilter) buildChunkList() {
 
 		// ctts - time offsets (b-frames)
 		if ctts := t.Mdia.Minf.Stbl.Ctts; ctts != nil {
-			sample = 0
+			newSampleCount, runs := cutRuns(ctts.SampleCount, cti.firstSample, cti.currentSample)
+			newSampleOffset := make([]uint32, 0, len(runs))
 
-			firstSample := cti.firstSample
-			currentSample := cti.currentSample
+			for _, i := range runs {
+				newSampleOffset = append(newSampleOffset, ctts.SampleOffset[i])
+			}
+
+			ctts.SampleCount = newSampleCount
+			ctts.SampleOffset = newSampleOffset
+		}
 
-			oldSampleCount := ctts.SampleCount
-			oldSampleOffset := ctts.SampleOffset
+		t.Mdia.Minf.Stbl.Stsc.FirstChunk = newFirstChunk[tnum]
+		t.Mdia.Minf.Stbl.SetChunkOffsets(newChunkOffset[tnum])
+		t.Mdia.Minf.Stbl.Stsc.SamplesPerChunk = newSamplesPerChunk[tnum]
+		t.Mdia.Minf.Stbl.Stsc.SampleDescriptionID = newSampleDescriptionID[tnum]
+	}
 
-			newSampleCount := make([]uint32, 0, len(oldSampleCount))
-			newSampleOffset := make([]uint32, 0, len(oldSampleOffset))
+	f.m.Moov.Mvhd.Duration = duration
 
-			for i := 0; i < len(oldSampleCount) && sample < currentSample; i++ {
-				if sample+oldSampleCount[i] >= firstSample {
-					current := oldSampleCount[i]
+	f.result = ClipResult{
+		Begin: f.begin,
+		End:   f.begin + stream.UnitsToDuration(duration, f.m.Moov.Mvhd.Timescale),
+	}
+}
 
-					if sample+oldSampleCount[i] >= firstSample && sample < firstSample {
-						current += sample - firstSample
-					}
+// checkTracks returns ErrMissingBox when the media lacks a box the filters use: mvhd, and for each track
+// tkhd, mdhd, and a sample table with stts, stsc, stsz and chunk offsets (stco or co64)
+func checkTracks(m *stream.MP4) error {
+	if m.Moov == nil || m.Moov.Mvhd == nil {
+		return ErrMissingBox
+	}
 
-					if sample+oldSampleCount[i] > currentSample {
-						current += currentSample - sample - oldSampleCount[i]
-					}
+	for _, t := range m.Moov.Trak {
+		if t.Tkhd == nil || t.Mdia == nil || t.Mdia.Mdhd == nil || t.Mdia.Minf == nil {
+			return ErrMissingBox
+		}
 
-					newSampleCount = append(newSampleCount, current)
-					newSampleOffset = append(newSampleOffset, oldSampleOffset[i])
-				}
+		stbl := t.Mdia.Minf.Stbl
+		if stbl == nil || stbl.Stts == nil || stbl.Stsc == nil || stbl.Stsz == nil || stbl.Stco == nil && stbl.Co64 == nil {
+			return ErrMissingBox
+		}
+	}
 
-				sample += oldSampleCount[i]
+	return nil
+}
+
+// mediaBegin returns the media time presented at the clip beginning, according to the edit list of a
+// track. When the beginning is in an empty edit, the media starts after a delay.
+func (f *clipFilter) mediaBegin(t *stream.TrakBox) (int64, time.Duration) {
+	ts := f.m.Moov.Mvhd.Timescale
+
+	if mt, ok := t.MediaTime(f.begin, ts); ok {
+		return mt, 0
+	}
+
+	if t.Edts != nil && t.Edts.Elst != nil {
+		for _, e := range t.Edts.Elst.Entries {
+			if e.MediaTime < 0 {
+				continue
+			}
+			if d, ok := t.PresentationTime(e.MediaTime, ts); ok && d > f.begin {
+				return e.MediaTime, d - f.begin
 			}
+		}
+	}
 
-			ctts.SampleCount = newSampleCount
-			ctts.SampleOffset = newSampleOffset
+	return 0, 0
+}
+
+// editTrak replaces the edit list of a track, so that the clip is presented from its beginning.
+// start is the decoding time of the first sample kept in the clip.
+func (f *clipFilter) editTrak(t *stream.TrakBox, cti *trakInfo, start uint64) {
+	ts := f.m.Moov.Mvhd.Timescale
+	elst := &stream.ElstBox{}
+
+	if cti.delay > 0 {
+		elst.Entries = append(elst.Entries, stream.ElstEntry{
+			SegmentDuration:  stream.DurationToUnits(cti.delay, ts),
+			MediaTime:        -1,
+			MediaRateInteger: 1,
+		})
+	}
+
+	if d := f.end - f.begin - cti.delay; d > 0 {
+		elst.Entries = append(elst.Entries, stream.ElstEntry{
+			SegmentDuration:  stream.DurationToUnits(d, ts),
+			MediaTime:        cti.mediaBegin - int64(start),
+			MediaRateInteger: 1,
+		})
+	}
+
+	if t.Edts == nil {
+		t.Edts = &stream.EdtsBox{}
+	}
+
+	t.Edts.Elst = elst
+	t.Tkhd.Duration = 0
+
+	for _, e := range elst.Entries {
+		t.Tkhd.Duration += e.SegmentDuration
+	}
+}
+
+// syncSampleBefore returns the last sync sample (starting at 0) presented at or before a media time.
+// For tracks without sync sample box, it returns the sample decoded at that time.
+func syncSampleBefore(t *stream.TrakBox, mediaTime int64) uint32 {
+	stbl := t.Mdia.Minf.Stbl
+
+	if mediaTime < 0 {
+		mediaTime = 0
+	}
+
+	if stbl.Stss == nil || t.Kind() != stream.TrackVideo {
+		return stbl.Stts.GetSample(uint64(mediaTime))
+	}
+
+	for i := len(stbl.Stss.SampleNumber) - 1; i >= 0; i-- {
+		sample := stbl.Stss.SampleNumber[i] - 1
+		ct := int64(stbl.Stts.GetTimeCode(sample))
+
+		if stbl.Ctts != nil {
+			ct += stbl.Ctts.GetOffset(sample)
 		}
 
-		// co64 ?
+		if ct <= mediaTime {
+			return sample
+		}
+	}
 
-		t.Mdia.Minf.Stbl.Stsc.FirstChunk = newFirstChunk[tnum]
-		t.Mdia.Minf.Stbl.Stco.ChunkOffset = newChunkOffset[tnum]
-		t.Mdia.Minf.Stbl.Stsc.SamplesPerChunk = newSamplesPerChunk[tnum]
-		t.Mdia.Minf.Stbl.Stsc.SampleDescriptionID = newSampleDescriptionID[tnum]
+	return 0
+}
+
+// lastSampleBefore returns the last sample (starting at 0) presented before a media time, and false
+// when no sample is presented before it.
+func lastSampleBefore(t *stream.TrakBox, mediaTime int64) (uint32, bool) {
+	stbl := t.Mdia.Minf.Stbl
+
+	if mediaTime <= 0 {
+		return 0, false
+	}
+
+	if stbl.Ctts == nil {
+		return stbl.Stts.GetSample(uint64(mediaTime - 1)), true
+	}
+
+	// Samples are not presented in decoding order: check all the samples that may be presented
+	// before the media time, according to the smallest composition offset.
+	ctts := stbl.Ctts
+	offsets := make([]int64, len(ctts.SampleOffset))
+
+	var minOffset int64
+
+	for i, o := range ctts.SampleOffset {
+		offsets[i] = int64(o)
+		if ctts.Version == 1 {
+			offsets[i] = int64(int32(o))
+		}
+		if offsets[i] < minOffset {
+			minOffset = offsets[i]
+		}
 	}
+
+	var dts int64
+	var sample, last, cn uint32
+	var found bool
+
+	ci := 0
+
+	for i := 0; i < len(stbl.Stts.SampleCount); i++ {
+		for n := uint32(0); n < stbl.Stts.SampleCount[i]; n++ {
+			if dts+minOffset >= mediaTime {
+				return last, found
+			}
+
+			for ci < len(ctts.SampleCount) && cn >= ctts.SampleCount[ci] {
+				ci, cn = ci+1, 0
+			}
+
+			ct := dts
+			if ci < len(offsets) {
+				ct += offsets[ci]
+			}
+
+			if ct < mediaTime {
+				last, found = sample, true
+			}
+
+			dts += int64(stbl.Stts.SampleTimeDelta[i])
+			sample++
+			cn++
+		}
+	}
+
+	return last, found
+}
+
+// cutRuns restricts a run-length table (stts, ctts) to the samples from first to end (excluded).
+// It returns the new sample counts and the indexes of the runs kept.
+func cutRuns(counts []uint32, first, end uint32) ([]uint32, []int) {
+	var sample uint32
+
+	newCounts := make([]uint32, 0, len(counts))
+	runs := make([]int, 0, len(counts))
+
+	for i := 0; i < len(counts) && sample < end; i++ {
+		from, to := sample, sample+counts[i]
+		sample = to
+
+		if from < first {
+			from = first
+		}
+
+		if to > end {
+			to = end
+		}
+
+		if from < to {
+			newCounts = append(newCounts, to-from)
+			runs = append(runs, i)
+		}
+	}
+
+	return newCounts, runs
 }
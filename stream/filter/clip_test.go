@@ -0,0 +1,210 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// sampleData returns the data of a sample of the test media, which tells its track and its index
+func sampleData(track, i int) []byte {
+	return bytes.Repeat([]byte(fmt.Sprintf("track %d sample %d;", track, i)), 5+i%7)
+}
+
+// presentation returns the presentation time of the video frame i of the test media. With B-frames, each
+// second is coded I P B B P B B ..., the frames being presented a frame later than decoded.
+func presentation(i int, bframes bool) int64 {
+	if j := i % 25; bframes && j > 0 {
+		if (j-1)%3 == 0 {
+			i += 2
+		} else {
+			i--
+		}
+	}
+	if bframes {
+		i++
+	}
+	return int64(i) * 3600
+}
+
+// writeTestMedia writes a media of 10s with a H.264 track (25 frames per second, a key frame per second)
+// and an AAC track, the moov box first
+func writeTestMedia(t *testing.T, name string, bframes bool) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m := &stream.Muxer{W: f, Faststart: true, TempDir: filepath.Dir(name)}
+
+	video := m.AddH264Track()
+	video.SetH264SPS([]byte{0x67, 0x64, 0, 0x1f})
+	video.SetH264PPS([]byte{0x68, 0xee})
+	video.SetResolution(640, 480)
+
+	audio := m.AddAACTrack(44100)
+	audio.SetAACConfig([]byte{0x12, 0x10})
+
+	if err = m.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, j := 0, 0; i < 250; i++ {
+		dts := int64(i) * 3600
+		if err = video.WriteSample(presentation(i, bframes), dts, i%25 == 0, sampleData(0, i)); err != nil {
+			t.Fatal(err)
+		}
+		for ; int64(j)*1024*90000 < (dts+3600)*44100; j++ {
+			if err = audio.WriteSample(int64(j)*1024, int64(j)*1024, true, sampleData(1, j)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err = m.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClipFile clips a media decoded from a file, and checks the data of the samples of the clip
+func TestClipFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "media.mp4")
+	writeTestMedia(t, name, false)
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	m, err := stream.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := Clip(m, 3*time.Second, 4*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = c.Filter(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &stream.Demuxer{R: bytes.NewReader(out)}
+	if err = d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Tracks) != 2 {
+		t.Fatalf("%d tracks in the clip", len(d.Tracks))
+	}
+
+	for ti, track := range d.Tracks {
+		var first, n int
+
+		for ; ; n++ {
+			_, _, _, data, err := track.ReadSample()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var i, k int
+			if _, err = fmt.Sscanf(string(data), "track %d sample %d;", &k, &i); err != nil {
+				t.Fatalf("track %d, sample %d: unexpected data %q", ti, n, data[:16])
+			}
+			if n == 0 {
+				first = i
+			}
+			if k != ti || i != first+n || !bytes.Equal(data, sampleData(ti, i)) {
+				t.Fatalf("track %d, sample %d: unexpected data %q", ti, n, data[:16])
+			}
+		}
+
+		if n == 0 {
+			t.Fatalf("track %d: no sample in the clip", ti)
+		}
+	}
+}
+
+// TestClipPrecise checks the edit lists of precise clips, which begin in the middle of a group of pictures
+// and of an audio frame
+func TestClipPrecise(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, bframes := range []bool{false, true} {
+		name := filepath.Join(dir, fmt.Sprintf("media-%v.mp4", bframes))
+		writeTestMedia(t, name, bframes)
+
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		m, err := stream.Decode(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := ClipPrecise(m, 2500*time.Millisecond, 4*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = c.Filter(); err != nil {
+			t.Fatal(err)
+		}
+
+		out, err := ioutil.ReadAll(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d, err := stream.DecodeSeeker(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 2.5s after the key frame at 2s (90000 units per second), and after the audio frame 107 (1024 units
+		// at 44100 units per second)
+		for i, want := range []int64{45000, 682} {
+			trak := d.Moov.Trak[i]
+
+			if trak.Edts == nil || trak.Edts.Elst == nil || len(trak.Edts.Elst.Entries) != 1 {
+				t.Fatalf("B-frames %v: track %d: no edit list of one entry", bframes, i)
+			}
+
+			e := trak.Edts.Elst.Entries[0]
+			if e.MediaTime != want || e.SegmentDuration != stream.DurationToUnits(4*time.Second, d.Moov.Mvhd.Timescale) {
+				t.Errorf("B-frames %v: track %d: got media time %d for %d units, want %d for 4s", bframes, i, e.MediaTime, e.SegmentDuration, want)
+			}
+
+			if s := d.Samples(trak); !s.Next() || !s.Sample().IsSync {
+				t.Errorf("B-frames %v: track %d: the clip doesn't begin with a sync sample", bframes, i)
+			}
+		}
+	}
+}
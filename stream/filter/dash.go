@@ -0,0 +1,183 @@
+package filter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// The MPD manifest of a presentation (static, ISO BMFF live profile)
+type mpd struct {
+	XMLName                   xml.Name  `xml:"MPD"`
+	Xmlns                     string    `xml:"xmlns,attr"`
+	Type                      string    `xml:"type,attr"`
+	Profiles                  string    `xml:"profiles,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string    `xml:"minBufferTime,attr"`
+	Period                    mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Id             string              `xml:"id,attr"`
+	Start          string              `xml:"start,attr"`
+	AdaptationSets []*mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	ContentType      string               `xml:"contentType,attr"`
+	MimeType         string               `xml:"mimeType,attr"`
+	SegmentAlignment bool                 `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                  `xml:"startWithSAP,attr"`
+	Representations  []*mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	Id                        string              `xml:"id,attr"`
+	Codecs                    string              `xml:"codecs,attr"`
+	Bandwidth                 uint64              `xml:"bandwidth,attr"`
+	Width                     uint16              `xml:"width,attr,omitempty"`
+	Height                    uint16              `xml:"height,attr,omitempty"`
+	AudioSamplingRate         uint32              `xml:"audioSamplingRate,attr,omitempty"`
+	AudioChannelConfiguration *mpdDescriptor      `xml:"AudioChannelConfiguration,omitempty"`
+	SegmentTemplate           *mpdSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+type mpdDescriptor struct {
+	SchemeIdUri string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type mpdSegmentTemplate struct {
+	Timescale      uint32     `xml:"timescale,attr"`
+	Initialization string     `xml:"initialization,attr"`
+	Media          string     `xml:"media,attr"`
+	StartNumber    int        `xml:"startNumber,attr"`
+	Timeline       []mpdEntry `xml:"SegmentTimeline>S"`
+}
+
+type mpdEntry struct {
+	T *uint64 `xml:"t,attr"`
+	D uint64  `xml:"d,attr"`
+	R int     `xml:"r,attr,omitempty"`
+}
+
+// WriteMPD writes the DASH manifest (MPD) of the presentation, init and media being the URL templates of
+// the segments, for example "$RepresentationID$/init.mp4" and "$RepresentationID$/$Number$.m4s"
+func (p *Presentation) WriteMPD(w io.Writer, init, media string) error {
+	var maxDuration time.Duration
+
+	sets := map[stream.TrackKind]*mpdAdaptationSet{}
+
+	m := &mpd{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Type:                      "static",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+		MediaPresentationDuration: mpdDuration(p.Duration),
+		Period: mpdPeriod{
+			Id:    "0",
+			Start: mpdDuration(0),
+		},
+	}
+
+	for _, r := range p.Representations {
+		set := sets[r.Kind]
+
+		if set == nil {
+			set = &mpdAdaptationSet{
+				ContentType:      r.Kind.String(),
+				MimeType:         r.mimeType(),
+				SegmentAlignment: true,
+				StartWithSAP:     1,
+			}
+			sets[r.Kind] = set
+			m.Period.AdaptationSets = append(m.Period.AdaptationSets, set)
+		}
+
+		mr := &mpdRepresentation{
+			Id:        r.Id,
+			Codecs:    r.Codecs,
+			Bandwidth: r.Bandwidth,
+			SegmentTemplate: &mpdSegmentTemplate{
+				Timescale:      r.Timescale,
+				Initialization: init,
+				Media:          media,
+				StartNumber:    1,
+			},
+		}
+
+		if r.Kind == stream.TrackVideo {
+			mr.Width, mr.Height = r.Width, r.Height
+		}
+
+		if r.Kind == stream.TrackAudio {
+			mr.AudioSamplingRate = r.SampleRate
+			mr.AudioChannelConfiguration = &mpdDescriptor{
+				SchemeIdUri: "urn:mpeg:dash:23003:3:audio_channel_configuration:2011",
+				Value:       fmt.Sprint(r.Channels),
+			}
+		}
+
+		// Segment timeline: a time is given when the segment doesn't follow the previous one, and
+		// segments of the same duration are repeated
+		var next uint64
+		timeline := mr.SegmentTemplate.Timeline
+
+		for i, s := range r.Segments {
+			if d := stream.UnitsToDuration(s.Duration, r.Timescale); d > maxDuration {
+				maxDuration = d
+			}
+
+			if n := len(timeline); i > 0 && s.Time == next && timeline[n-1].D == s.Duration {
+				timeline[n-1].R++
+			} else {
+				e := mpdEntry{D: s.Duration}
+				if i == 0 || s.Time != next {
+					t := s.Time
+					e.T = &t
+				}
+				timeline = append(timeline, e)
+			}
+
+			next = s.Time + s.Duration
+		}
+
+		mr.SegmentTemplate.Timeline = timeline
+		set.Representations = append(set.Representations, mr)
+	}
+
+	m.MinBufferTime = mpdDuration(maxDuration)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	e := xml.NewEncoder(w)
+	e.Indent("", "  ")
+
+	if err := e.Encode(m); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// mimeType returns the MIME type of the segments of the representation
+func (r *Representation) mimeType() string {
+	switch r.Kind {
+	case stream.TrackVideo:
+		return "video/mp4"
+	case stream.TrackAudio:
+		return "audio/mp4"
+	}
+	return "application/mp4"
+}
+
+// mpdDuration formats a duration as a xs:duration
+func mpdDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", d.Seconds())
+}
@@ -0,0 +1,90 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// segmentMedia splits a media into segments of a second
+func segmentMedia(t *testing.T, src []byte, mode FragmentMode) *Presentation {
+	m, err := stream.DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Segment(m, time.Second, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+// TestSegment segments the test medias a representation per track, and checks their MPD and the samples of
+// their representations
+func TestSegment(t *testing.T) {
+	t0 := uint64(0)
+
+	// The video segments last a second, the audio segments are split at the same times
+	timelines := map[string][]mpdEntry{
+		"avc1.64001f": {{T: &t0, D: 12800, R: 3}},
+		"mp4a.40.2":   {{T: &t0, D: 45056}, {D: 44032, R: 1}, {D: 87040}},
+	}
+
+	for name, src := range testMedias(t) {
+		p := segmentMedia(t, src, FragmentPerTrack)
+
+		var b bytes.Buffer
+		if err := p.WriteMPD(&b, "$RepresentationID$/init.mp4", "$RepresentationID$/$Number$.m4s"); err != nil {
+			t.Fatal(name, err)
+		}
+
+		var manifest mpd
+		if err := xml.Unmarshal(b.Bytes(), &manifest); err != nil {
+			t.Fatal(name, err)
+		}
+
+		if sets := manifest.Period.AdaptationSets; len(sets) != 2 || len(sets[0].Representations) != 1 || len(sets[1].Representations) != 1 {
+			t.Fatalf("%s: the MPD doesn't have an adaptation set per track", name)
+		}
+
+		m, err := stream.DecodeSeeker(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		samples := demuxSamples(t, src)
+
+		for _, set := range manifest.Period.AdaptationSets {
+			mr := set.Representations[0]
+
+			if want, ok := timelines[mr.Codecs]; !ok || !reflect.DeepEqual(mr.SegmentTemplate.Timeline, want) {
+				t.Fatalf("%s: representation %s: unexpected codecs %q or segment timeline", name, mr.Id, mr.Codecs)
+			}
+
+			// The representation holds the samples of its track
+			for _, r := range p.Representations {
+				if r.Id != mr.Id {
+					continue
+				}
+
+				data, err := ioutil.ReadAll(r.Reader())
+				if err != nil {
+					t.Fatal(name, err)
+				}
+
+				for i, trak := range m.Moov.Trak {
+					if r.Codecs == trak.Codec() {
+						checkSamples(t, name+" "+r.Id, demuxSamples(t, data), samples[i:i+1])
+					}
+				}
+			}
+		}
+	}
+}
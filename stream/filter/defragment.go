@@ -0,0 +1,206 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+var (
+	ErrNotFragmented = errors.New("media is not fragmented")
+)
+
+type defragmentFilter struct {
+	chunkReader
+
+	m *stream.MP4
+}
+
+// A run of samples of a track, following each other in the source media
+type defragmentChunk struct {
+	oldOffset   int64
+	newOffset   int64
+	size        int64
+	samples     uint32
+	description uint32
+}
+
+// Defragment returns a filter that converts a fragmented media (fMP4) to a progressive media, decoded
+// with DecodeSeeker or DecodeReaderAt to list all the fragments
+func Defragment(m *stream.MP4) (FilterInterface, error) {
+	if len(m.Fragments) == 0 {
+		return nil, ErrNotFragmented
+	}
+
+	return &defragmentFilter{
+		m: m,
+	}, nil
+}
+
+func (f *defragmentFilter) Filter() (err error) {
+	var chunks []*defragmentChunk
+	var mdatSize uint64
+	var duration uint64
+
+	builders := make([]*stream.SampleTableBuilder, len(f.m.Moov.Trak))
+	trakChunks := make([][]*defragmentChunk, len(f.m.Moov.Trak))
+
+	for tnum, t := range f.m.Moov.Trak {
+		var last *defragmentChunk
+
+		b := stream.NewSampleTableBuilder()
+		builders[tnum] = b
+
+		it := f.m.Samples(t)
+		for it.Next() {
+			s := it.Sample()
+			b.AddSample(s.Duration, int32(s.PTS-int64(s.DTS)), s.Size, s.IsSync)
+
+			if last == nil || last.oldOffset+last.size != s.Offset || last.description != s.DescriptionIndex {
+				last = &defragmentChunk{
+					oldOffset:   s.Offset,
+					description: s.DescriptionIndex,
+				}
+				chunks = append(chunks, last)
+				trakChunks[tnum] = append(trakChunks[tnum], last)
+			}
+
+			last.size += int64(s.Size)
+			last.samples++
+		}
+		if err = it.Err(); err != nil {
+			return
+		}
+	}
+
+	// The chunks are written in the order of the source media
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].oldOffset < chunks[j].oldOffset
+	})
+
+	for _, c := range chunks {
+		c.newOffset = int64(mdatSize)
+		mdatSize += uint64(c.size)
+	}
+
+	for tnum, t := range f.m.Moov.Trak {
+		b := builders[tnum]
+
+		for _, c := range trakChunks[tnum] {
+			b.AddChunk(uint64(c.newOffset), c.samples, c.description)
+		}
+
+		t.Mdia.Minf.Stbl = rebuildSampleTable(t.Mdia.Minf.Stbl, b)
+		t.Mdia.Mdhd.Duration = b.Duration()
+
+		if t.Edts == nil || t.Tkhd.Duration == 0 {
+			t.Tkhd.Duration = stream.RescaleUnits(b.Duration(), t.Mdia.Mdhd.Timescale, f.m.Moov.Mvhd.Timescale)
+		}
+
+		if t.Tkhd.Duration > duration {
+			duration = t.Tkhd.Duration
+		}
+	}
+
+	f.m.Moov.Mvex = nil
+	f.m.Moov.Mvhd.Duration = duration
+
+	// The brands of segmented medias no longer apply
+	segmented := []string{stream.BrandCmfc, stream.BrandDash, stream.BrandMsdh, stream.BrandMsix}
+
+	ftyp := f.m.FileType()
+	ftyp.RemoveBrands(segmented...)
+
+	for _, brand := range segmented {
+		if ftyp.MajorBrand == brand {
+			ftyp.SetMajorBrand(stream.BrandIsom, 0x200)
+		}
+	}
+
+	// The boxes describing the fragments (segment index, random access) are removed
+	var boxes []stream.Box
+
+	for _, b := range f.m.Boxes() {
+		switch b.Type() {
+		case "mdat", "sidx", "mfra", "styp":
+		default:
+			boxes = append(boxes, b)
+		}
+	}
+
+	head := []stream.Box{ftyp, f.m.Moov}
+	head = append(head, boxes...)
+
+	mdat := &stream.MdatBox{
+		ContentSize: mdatSize,
+	}
+
+	// Update chunk offset
+	stream.RelocateChunks(f.m.Moov, func(int) uint64 {
+		bsz := uint64(mdat.HeaderSize())
+
+		for _, b := range head {
+			bsz += uint64(b.Size())
+		}
+
+		return bsz
+	})
+
+	// Prepare blob with ftyp, moov and other small atoms
+	buffer := &bytes.Buffer{}
+
+	for _, b := range head {
+		if err = b.Encode(buffer); err != nil {
+			return
+		}
+	}
+
+	if err = mdat.EncodeHeader(buffer); err != nil {
+		return
+	}
+
+	f.addData(buffer.Bytes())
+
+	for _, c := range chunks {
+		f.addChunk(c.oldOffset, c.size)
+	}
+
+	if f.m.Mdat != nil {
+		f.reader = f.m.Mdat.Reader()
+	}
+
+	for _, fr := range f.m.Fragments {
+		if f.reader == nil && fr.Mdat != nil {
+			f.reader = fr.Mdat.Reader()
+		}
+	}
+
+	f.m = nil
+
+	return
+}
+
+// rebuildSampleTable returns the sample table built by b, with the children of the former sample table
+// which aren't rebuilt (sgpd, sbgp, sdtp, subs, ...)
+func rebuildSampleTable(old *stream.StblBox, b *stream.SampleTableBuilder) *stream.StblBox {
+	if old == nil {
+		return b.Build(nil)
+	}
+
+	stbl := b.Build(old.Stsd)
+	l := stbl.Children()
+
+	for _, c := range old.Children() {
+		switch c.Type() {
+		case "stsd", "stts", "ctts", "stss", "stsc", "stsz", "stco", "co64":
+		default:
+			l = append(l, c)
+		}
+	}
+
+	stbl.SetChildren(l)
+
+	return stbl
+}
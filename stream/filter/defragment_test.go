@@ -0,0 +1,51 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// TestDefragment converts fragmented medias back to progressive medias, and checks that their samples are
+// the samples of the progressive media they come from
+func TestDefragment(t *testing.T) {
+	type fragmented struct {
+		src     []byte
+		samples [][]demuxedSample
+	}
+
+	files := map[string]fragmented{}
+
+	for name, src := range testMedias(t) {
+		for _, mode := range []FragmentMode{FragmentCombined, FragmentPerTrack} {
+			files[fmt.Sprintf("%s (mode %d)", name, mode)] = fragmented{filterMedia(t, src, fragmenter(time.Second, mode)), demuxSamples(t, src)}
+		}
+	}
+
+	name := filepath.Join("..", "testdata", "fragmented.mp4")
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files[name] = fragmented{src, demuxSamples(t, src)}
+
+	for name, f := range files {
+		out := filterMedia(t, f.src, Defragment)
+
+		m, err := stream.DecodeSeeker(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		if len(m.Fragments) > 0 || m.Moov.Mvex != nil || m.Mdat == nil {
+			t.Fatalf("%s: the media is still fragmented", name)
+		}
+
+		checkSamples(t, name, demuxSamples(t, out), f.samples)
+	}
+}
@@ -0,0 +1,151 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+var (
+	ErrChunkOutside = errors.New("chunk is outside media data")
+)
+
+type faststartFilter struct {
+	chunkReader
+
+	m *stream.MP4
+}
+
+// Faststart returns a filter that moves the moov box before the media data (progressive download)
+// A media having the moov box at the end must be decoded with DecodeSeeker or DecodeReaderAt.
+func Faststart(m *stream.MP4) (FilterInterface, error) {
+	if len(m.Fragments) > 0 {
+		return nil, ErrFragmented
+	}
+
+	return &faststartFilter{
+		m: m,
+	}, nil
+}
+
+func (f *faststartFilter) Filter() (err error) {
+	var head, boxes []stream.Box
+	var mdats []*stream.MdatBox
+
+	if f.m.Mdat != nil {
+		mdats = append(mdats, f.m.Mdat)
+	}
+
+	if f.m.Ftyp != nil {
+		head = append(head, f.m.Ftyp)
+	}
+
+	for _, b := range f.m.Boxes() {
+		switch b.Type() {
+		case "mdat":
+			mdats = append(mdats, b.(*stream.MdatBox))
+		default:
+			boxes = append(boxes, b)
+		}
+	}
+
+	sort.Slice(mdats, func(i, j int) bool {
+		return mdats[i].Offset < mdats[j].Offset
+	})
+
+	head = append(head, f.m.Moov)
+	head = append(head, boxes...)
+
+	// Update chunk offset, each chunk moving with its mdat box: the offsets are first made relative to
+	// the end of the boxes preceding the mdat boxes
+	var pos int64
+
+	starts := make([]int64, len(mdats))
+
+	for i, mdat := range mdats {
+		pos += int64(mdat.HeaderSize())
+		starts[i] = pos
+		pos += int64(mdat.ContentSize)
+	}
+
+	for _, t := range f.m.Moov.Trak {
+		stbl := chunkTable(t)
+		if stbl == nil {
+			continue
+		}
+
+		l := stbl.ChunkOffsets()
+		for i, o := range l {
+			if l[i], err = moveOffset(o, mdats, starts); err != nil {
+				return
+			}
+		}
+		stbl.SetChunkOffsets(l)
+	}
+
+	stream.RelocateChunks(f.m.Moov, func(int) uint64 {
+		var bsz uint64
+
+		for _, b := range head {
+			bsz += uint64(b.Size())
+		}
+
+		return bsz
+	})
+
+	// Prepare blob with ftyp, moov and other small atoms
+	buffer := &bytes.Buffer{}
+
+	for _, b := range head {
+		if err = b.Encode(buffer); err != nil {
+			return
+		}
+	}
+
+	f.addData(buffer.Bytes())
+
+	for _, mdat := range mdats {
+		buffer = &bytes.Buffer{}
+
+		if err = mdat.EncodeHeader(buffer); err != nil {
+			return
+		}
+
+		f.addData(buffer.Bytes())
+		f.addChunk(mdat.Offset+int64(mdat.HeaderSize()), int64(mdat.ContentSize))
+
+		if f.reader == nil {
+			f.reader = mdat.Reader()
+		}
+	}
+
+	f.m = nil
+
+	return
+}
+
+// chunkTable returns the sample table of a track, or nil when the track has no chunk offsets to move
+func chunkTable(t *stream.TrakBox) *stream.StblBox {
+	if t.Mdia == nil || t.Mdia.Minf == nil {
+		return nil
+	}
+	if stbl := t.Mdia.Minf.Stbl; stbl != nil && (stbl.Stco != nil || stbl.Co64 != nil) {
+		return stbl
+	}
+	return nil
+}
+
+// moveOffset returns the new offset of a chunk, starts being the new content offsets of the mdat boxes
+func moveOffset(o uint64, mdats []*stream.MdatBox, starts []int64) (uint64, error) {
+	for i, mdat := range mdats {
+		start := uint64(mdat.Offset) + uint64(mdat.HeaderSize())
+
+		if o >= start && o <= start+mdat.ContentSize {
+			return o - start + uint64(starts[i]), nil
+		}
+	}
+
+	return 0, ErrChunkOutside
+}
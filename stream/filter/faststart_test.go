@@ -0,0 +1,130 @@
+package filter
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// A sample read by a demuxer
+type demuxedSample struct {
+	pts, dts int64
+	sync     bool
+	data     []byte
+}
+
+// testMedias returns the progressive test medias of the stream package
+func testMedias(t *testing.T) map[string][]byte {
+	names, err := filepath.Glob(filepath.Join("..", "testdata", "*.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+
+	for _, name := range names {
+		if filepath.Base(name) == "fragmented.mp4" {
+			continue
+		}
+		if files[name], err = ioutil.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no test media")
+	}
+
+	return files
+}
+
+// filterMedia decodes a media, and returns the media filtered by filter
+func filterMedia(t *testing.T, src []byte, filter func(*stream.MP4) (FilterInterface, error)) []byte {
+	m, err := stream.DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := filter(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.Filter(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return out
+}
+
+// demuxSamples reads the samples of each track of a media
+func demuxSamples(t *testing.T, src []byte) [][]demuxedSample {
+	d := &stream.Demuxer{R: bytes.NewReader(src)}
+	if err := d.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := make([][]demuxedSample, len(d.Tracks))
+
+	for i, track := range d.Tracks {
+		for {
+			pts, dts, sync, data, err := track.ReadSample()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			samples[i] = append(samples[i], demuxedSample{pts, dts, sync, data})
+		}
+	}
+
+	return samples
+}
+
+// checkSamples checks that the samples of a filtered media are the samples of the source media
+func checkSamples(t *testing.T, name string, got, want [][]demuxedSample) {
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d tracks, want %d", name, len(got), len(want))
+	}
+
+	for i := range want {
+		if len(got[i]) != len(want[i]) {
+			t.Fatalf("%s: track %d: got %d samples, want %d", name, i, len(got[i]), len(want[i]))
+		}
+
+		for j, s := range want[i] {
+			if g := got[i][j]; g.pts != s.pts || g.dts != s.dts || g.sync != s.sync || !bytes.Equal(g.data, s.data) {
+				t.Fatalf("%s: track %d: sample %d differs from the source sample", name, i, j)
+			}
+		}
+	}
+}
+
+// TestFaststart moves the moov box of the test medias first, and checks that the media can then be
+// decoded without seeking, with the same samples
+func TestFaststart(t *testing.T) {
+	for name, src := range testMedias(t) {
+		out := filterMedia(t, src, Faststart)
+
+		m, err := stream.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		if m.Ftyp == nil || len(m.Moov.Trak) == 0 || string(out[4:8]) != "ftyp" || m.Mdat.Offset < int64(m.Ftyp.Size()+m.Moov.Size()) {
+			t.Fatalf("%s: the moov box doesn't precede the media data", name)
+		}
+
+		checkSamples(t, name, demuxSamples(t, out), demuxSamples(t, src))
+	}
+}
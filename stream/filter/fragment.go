@@ -0,0 +1,385 @@
+package filter
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// ErrFragmentTooLarge is returned when the data offset of a track run of a fragment doesn't fit in 32 bits
+var ErrFragmentTooLarge = errors.New("fragment data offset overflows")
+
+// FragmentMode tells how the tracks are grouped into fragments
+type FragmentMode int
+
+const (
+	// FragmentCombined writes a single fragment (moof and mdat) holding all the tracks for each period
+	FragmentCombined FragmentMode = iota
+	// FragmentPerTrack writes a fragment for each track and each period
+	FragmentPerTrack
+)
+
+type fragmentFilter struct {
+	chunkReader
+
+	m        *stream.MP4
+	duration time.Duration
+	mode     FragmentMode
+}
+
+// The samples of a track, split into fragments
+type fragmentTrack struct {
+	trak    *stream.TrakBox
+	samples []stream.Sample
+	bounds  []int
+	signed  bool
+	ctts    bool
+}
+
+// Fragment returns a filter that converts a media to a fragmented media (fMP4), the fragments lasting
+// about duration and beginning on a key frame of the first video track
+func Fragment(m *stream.MP4, duration time.Duration, mode FragmentMode) (FilterInterface, error) {
+	if m.Mdat == nil || len(m.Fragments) > 0 {
+		return nil, ErrFragmented
+	}
+
+	if duration <= 0 {
+		return nil, ErrInvalidDuration
+	}
+
+	if err := checkTracks(m); err != nil {
+		return nil, err
+	}
+
+	return &fragmentFilter{
+		m:        m,
+		duration: duration,
+		mode:     mode,
+	}, nil
+}
+
+func (f *fragmentFilter) Filter() (err error) {
+	tracks, err := fragmentTracks(f.m)
+	if err != nil {
+		return
+	}
+
+	splitTracks(tracks, f.duration)
+
+	for _, ft := range tracks {
+		if err = ft.removeSamples(); err != nil {
+			return
+		}
+	}
+
+	if f.m.Moov.Mvex, err = newMvex(f.m.Moov.Mvhd.Duration, tracks); err != nil {
+		return
+	}
+
+	// ftyp, moov and other small atoms
+	buffer := &bytes.Buffer{}
+
+	f.m.AddBrands(stream.BrandIso6)
+
+	if err = f.m.Ftyp.Encode(buffer); err != nil {
+		return
+	}
+
+	if err = f.m.Moov.Encode(buffer); err != nil {
+		return
+	}
+
+	for _, b := range f.m.Boxes() {
+		if b.Type() != "mdat" {
+			if err = b.Encode(buffer); err != nil {
+				return
+			}
+		}
+	}
+
+	f.addData(buffer.Bytes())
+
+	// moof and mdat boxes
+	var sequence uint32
+
+	fragments := 0
+	for _, ft := range tracks {
+		if len(ft.bounds)-1 > fragments {
+			fragments = len(ft.bounds) - 1
+		}
+	}
+
+	for i := 0; i < fragments; i++ {
+		if f.mode == FragmentPerTrack {
+			for _, ft := range tracks {
+				if ft.fragmentSamples(i) != nil {
+					sequence++
+					if err = f.addFragment(sequence, i, []*fragmentTrack{ft}); err != nil {
+						return
+					}
+				}
+			}
+			continue
+		}
+
+		sequence++
+		if err = f.addFragment(sequence, i, tracks); err != nil {
+			return
+		}
+	}
+
+	f.reader = f.m.Mdat.Reader()
+	f.m = nil
+
+	return
+}
+
+// fragmentTracks lists the samples of the tracks of a media
+func fragmentTracks(m *stream.MP4) ([]*fragmentTrack, error) {
+	tracks := make([]*fragmentTrack, 0, len(m.Moov.Trak))
+
+	for _, t := range m.Moov.Trak {
+		ft := &fragmentTrack{
+			trak: t,
+			ctts: t.Mdia.Minf.Stbl.Ctts != nil,
+		}
+
+		it := m.Samples(t)
+		for it.Next() {
+			s := it.Sample()
+			if s.PTS < int64(s.DTS) {
+				ft.signed = true
+			}
+			ft.samples = append(ft.samples, s)
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+
+		tracks = append(tracks, ft)
+	}
+
+	return tracks, nil
+}
+
+// splitTracks splits the samples of the tracks into fragments of about duration
+func splitTracks(tracks []*fragmentTrack, duration time.Duration) {
+	if len(tracks) == 0 {
+		return
+	}
+
+	// The reference track: the first video track, the first track otherwise
+	ref := tracks[0]
+	for _, ft := range tracks {
+		if ft.trak.Kind() == stream.TrackVideo {
+			ref = ft
+			break
+		}
+	}
+
+	var times []time.Duration
+
+	timescale := ref.trak.Mdia.Mdhd.Timescale
+	target := stream.DurationToUnits(duration, timescale)
+
+	for i, s := range ref.samples {
+		if i == 0 || (s.IsSync && s.DTS-ref.samples[ref.bounds[len(ref.bounds)-1]].DTS >= target) {
+			ref.bounds = append(ref.bounds, i)
+			times = append(times, stream.UnitsToDuration(s.DTS, timescale))
+		}
+	}
+
+	ref.bounds = append(ref.bounds, len(ref.samples))
+
+	// The other tracks are split at the beginning time of each fragment
+	for _, ft := range tracks {
+		if ft == ref {
+			continue
+		}
+
+		timescale := ft.trak.Mdia.Mdhd.Timescale
+		ft.bounds = append(ft.bounds, 0)
+
+		for j, n := 1, 0; j < len(times); j++ {
+			begin := stream.DurationToUnits(times[j], timescale)
+			for n < len(ft.samples) && ft.samples[n].DTS < begin {
+				n++
+			}
+			ft.bounds = append(ft.bounds, n)
+		}
+
+		ft.bounds = append(ft.bounds, len(ft.samples))
+	}
+}
+
+// fragmentSamples returns the samples of the fragment i of a track, or nil
+func (ft *fragmentTrack) fragmentSamples(i int) []stream.Sample {
+	if i+1 >= len(ft.bounds) || ft.bounds[i] == ft.bounds[i+1] {
+		return nil
+	}
+	return ft.samples[ft.bounds[i]:ft.bounds[i+1]]
+}
+
+// removeSamples empties the sample table of the track, the samples being described by fragments
+func (ft *fragmentTrack) removeSamples() error {
+	if ft.trak.Mdia == nil || ft.trak.Mdia.Minf == nil || ft.trak.Mdia.Minf.Stbl == nil {
+		return ErrMissingBox
+	}
+	stbl := ft.trak.Mdia.Minf.Stbl
+	ft.trak.Mdia.Minf.Stbl = stream.NewSampleTableBuilder().Build(stbl.Stsd)
+	return nil
+}
+
+// newMvex returns the movie extends box (mvex) of some tracks, duration being in the movie timescale
+func newMvex(duration uint64, tracks []*fragmentTrack) (*stream.MvexBox, error) {
+	mvex := &stream.MvexBox{
+		Mehd: &stream.MehdBox{
+			FragmentDuration: duration,
+		},
+	}
+
+	for _, ft := range tracks {
+		if ft.trak.Tkhd == nil {
+			return nil, ErrMissingBox
+		}
+		mvex.Trex = append(mvex.Trex, &stream.TrexBox{
+			TrackId:                       ft.trak.Tkhd.TrackId,
+			DefaultSampleDescriptionIndex: 1,
+		})
+	}
+
+	return mvex, nil
+}
+
+// addFragment adds the moof and mdat boxes of the fragment i of some tracks
+func (f *fragmentFilter) addFragment(sequence uint32, i int, tracks []*fragmentTrack) (err error) {
+	moof, mdat, err := buildFragment(sequence, i, tracks)
+	if err != nil {
+		return
+	}
+
+	buffer := &bytes.Buffer{}
+
+	if err = moof.Encode(buffer); err != nil {
+		return
+	}
+
+	if err = mdat.EncodeHeader(buffer); err != nil {
+		return
+	}
+
+	f.addData(buffer.Bytes())
+	f.addSamples(i, tracks)
+
+	return
+}
+
+// addSamples adds the data of the samples of the fragment i of some tracks
+func (f *chunkReader) addSamples(i int, tracks []*fragmentTrack) {
+	for _, ft := range tracks {
+		for _, s := range ft.fragmentSamples(i) {
+			f.addChunk(s.Offset, int64(s.Size))
+		}
+	}
+}
+
+// buildFragment returns the moof box and the header of the mdat box of the fragment i of some tracks.
+// The samples of the tracks follow each other in the mdat box.
+func buildFragment(sequence uint32, i int, tracks []*fragmentTrack) (*stream.MoofBox, *stream.MdatBox, error) {
+	var size uint64
+	var offsets []uint64
+
+	moof := &stream.MoofBox{
+		Mfhd: &stream.MfhdBox{
+			SequenceNumber: sequence,
+		},
+	}
+
+	for _, ft := range tracks {
+		samples := ft.fragmentSamples(i)
+		if samples == nil {
+			continue
+		}
+
+		traf, err := ft.traf(samples)
+		if err != nil {
+			return nil, nil, err
+		}
+		moof.Traf = append(moof.Traf, traf)
+		offsets = append(offsets, size)
+
+		for _, s := range samples {
+			size += uint64(s.Size)
+		}
+	}
+
+	mdat := &stream.MdatBox{
+		ContentSize: size,
+	}
+
+	// Data offsets are relative to the moof box
+	for n, traf := range moof.Traf {
+		offset := offsets[n] + uint64(moof.Size()+mdat.HeaderSize())
+		if offset > math.MaxInt32 {
+			return nil, nil, ErrFragmentTooLarge
+		}
+		traf.Trun[0].DataOffset = int32(offset)
+	}
+
+	return moof, mdat, nil
+}
+
+// traf returns the track fragment box describing some samples of a track
+func (ft *fragmentTrack) traf(samples []stream.Sample) (*stream.TrafBox, error) {
+	if ft.trak.Tkhd == nil {
+		return nil, ErrMissingBox
+	}
+
+	tfhd := &stream.TfhdBox{
+		TrackId: ft.trak.Tkhd.TrackId,
+	}
+	tfhd.SetFlags(stream.TfhdDefaultBaseIsMoof, true)
+
+	if d := samples[0].DescriptionIndex; d != 1 {
+		tfhd.SampleDescriptionIndex = d
+		tfhd.SetFlags(stream.TfhdSampleDescriptionIndexPresent, true)
+	}
+
+	trun := &stream.TrunBox{
+		Samples: make([]stream.TrunSample, 0, len(samples)),
+	}
+	trun.SetFlags(stream.TrunDataOffsetPresent|stream.TrunSampleDurationPresent|stream.TrunSampleSizePresent|stream.TrunSampleFlagsPresent, true)
+
+	if ft.ctts {
+		trun.SetFlags(stream.TrunSampleCompositionTimeOffsetPresent, true)
+	}
+
+	if ft.signed {
+		trun.Version = 1
+	}
+
+	for _, s := range samples {
+		flags := uint32(stream.SampleFlagDependsOnNoOthers)
+		if !s.IsSync {
+			flags = stream.SampleFlagIsNonSync | stream.SampleFlagDependsOnOthers
+		}
+
+		trun.Samples = append(trun.Samples, stream.TrunSample{
+			Duration:              s.Duration,
+			Size:                  s.Size,
+			Flags:                 flags,
+			CompositionTimeOffset: int32(s.PTS - int64(s.DTS)),
+		})
+	}
+
+	return &stream.TrafBox{
+		Tfhd: tfhd,
+		Tfdt: &stream.TfdtBox{
+			BaseMediaDecodeTime: samples[0].DTS,
+		},
+		Trun: []*stream.TrunBox{trun},
+	}, nil
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// fragmenter returns a fragment filter constructor for filterMedia
+func fragmenter(duration time.Duration, mode FragmentMode) func(*stream.MP4) (FilterInterface, error) {
+	return func(m *stream.MP4) (FilterInterface, error) {
+		return Fragment(m, duration, mode)
+	}
+}
+
+// TestFragment fragments the test medias, and checks the fragments and their samples
+func TestFragment(t *testing.T) {
+	for name, src := range testMedias(t) {
+		want := demuxSamples(t, src)
+
+		for _, mode := range []FragmentMode{FragmentCombined, FragmentPerTrack} {
+			test := fmt.Sprintf("%s (mode %d)", name, mode)
+			out := filterMedia(t, src, fragmenter(time.Second, mode))
+
+			m, err := stream.DecodeSeeker(bytes.NewReader(out))
+			if err != nil {
+				t.Fatal(test, err)
+			}
+
+			if m.Moov.Mvex == nil || len(m.Moov.Mvex.Trex) != len(m.Moov.Trak) {
+				t.Fatalf("%s: the movie extends box doesn't list the tracks", test)
+			}
+
+			// A fragment per second of each track, the video fragments beginning on a key frame
+			if n := 4 * (1 + int(mode)); len(m.Fragments) != n {
+				t.Fatalf("%s: got %d fragments, want %d", test, len(m.Fragments), n)
+			}
+
+			first := 0
+
+			for i, f := range m.Fragments {
+				if mode == FragmentPerTrack && len(f.Moof.Traf) != 1 || mode == FragmentCombined && len(f.Moof.Traf) != 2 {
+					t.Fatalf("%s: fragment %d: got %d track fragments", test, i, len(f.Moof.Traf))
+				}
+
+				for _, traf := range f.Moof.Traf {
+					if traf.Tfhd.TrackId != m.Moov.Trak[0].Tkhd.TrackId {
+						continue
+					}
+
+					if !want[0][first].sync {
+						t.Fatalf("%s: fragment %d: the video fragment doesn't begin on a key frame", test, i)
+					}
+
+					for _, trun := range traf.Trun {
+						first += len(trun.Samples)
+					}
+				}
+			}
+
+			checkSamples(t, test, demuxSamples(t, out), want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// WritePlaylist writes the HLS media playlist of the representation, each segment being a file (URI
+// templates as in WriteMPD)
+func (r *Representation) WritePlaylist(w io.Writer, init, media string) error {
+	return r.writePlaylist(w, func(b *bufio.Writer) {
+		fmt.Fprintf(b, "#EXT-X-MAP:URI=%q\n", segmentURI(init, r.Id, 0))
+	}, func(b *bufio.Writer, s *MediaSegment) {
+		fmt.Fprintln(b, segmentURI(media, r.Id, s.Number))
+	})
+}
+
+// WriteByteRangePlaylist writes the HLS media playlist of the representation, all the segments being
+// in a single file (see Reader) whose URI is uri
+func (r *Representation) WriteByteRangePlaylist(w io.Writer, uri string) error {
+	uri = segmentURI(uri, r.Id, 0)
+
+	return r.writePlaylist(w, func(b *bufio.Writer) {
+		fmt.Fprintf(b, "#EXT-X-MAP:URI=%q,BYTERANGE=\"%d@0\"\n", uri, len(r.Init))
+	}, func(b *bufio.Writer, s *MediaSegment) {
+		fmt.Fprintf(b, "#EXT-X-BYTERANGE:%d@%d\n", s.Size, s.Offset)
+		fmt.Fprintln(b, uri)
+	})
+}
+
+// writePlaylist writes a media playlist, the initialization and media segments being written by functions
+func (r *Representation) writePlaylist(w io.Writer, init func(*bufio.Writer), media func(*bufio.Writer, *MediaSegment)) error {
+	var target float64
+
+	for _, s := range r.Segments {
+		target = math.Max(target, r.seconds(s.Duration))
+	}
+
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "#EXTM3U")
+	fmt.Fprintln(b, "#EXT-X-VERSION:7")
+	fmt.Fprintf(b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(target)))
+	fmt.Fprintln(b, "#EXT-X-MEDIA-SEQUENCE:1")
+	fmt.Fprintln(b, "#EXT-X-PLAYLIST-TYPE:VOD")
+	fmt.Fprintln(b, "#EXT-X-INDEPENDENT-SEGMENTS")
+
+	init(b)
+
+	for _, s := range r.Segments {
+		fmt.Fprintf(b, "#EXTINF:%.3f,\n", r.seconds(s.Duration))
+		media(b, s)
+	}
+
+	fmt.Fprintln(b, "#EXT-X-ENDLIST")
+
+	return b.Flush()
+}
+
+// WriteMasterPlaylist writes the HLS master playlist of the presentation, playlist being the URI template
+// of the media playlists
+func (p *Presentation) WriteMasterPlaylist(w io.Writer, playlist string) error {
+	var video, audio []*Representation
+	var audioBandwidth uint64
+	var audioCodecs string
+
+	for _, r := range p.Representations {
+		if r.Kind == stream.TrackAudio {
+			audio = append(audio, r)
+		} else {
+			video = append(video, r)
+		}
+	}
+
+	if len(video) == 0 {
+		video, audio = audio, nil
+	}
+
+	b := bufio.NewWriter(w)
+
+	fmt.Fprintln(b, "#EXTM3U")
+	fmt.Fprintln(b, "#EXT-X-VERSION:7")
+	fmt.Fprintln(b, "#EXT-X-INDEPENDENT-SEGMENTS")
+
+	for i, r := range audio {
+		def := "NO"
+		if i == 0 {
+			def = "YES"
+		}
+
+		fmt.Fprintf(b, "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"audio\",NAME=\"audio_%s\",DEFAULT=%s,AUTOSELECT=YES,CHANNELS=\"%d\",URI=%q\n",
+			r.Id, def, r.Channels, segmentURI(playlist, r.Id, 0))
+
+		if r.Bandwidth > audioBandwidth {
+			audioBandwidth = r.Bandwidth
+		}
+
+		if i == 0 {
+			audioCodecs = r.Codecs
+		}
+	}
+
+	for _, r := range video {
+		attrs := []string{
+			"BANDWIDTH=" + strconv.FormatUint(r.Bandwidth+audioBandwidth, 10),
+		}
+
+		codecs := r.Codecs
+		if audioCodecs != "" {
+			codecs += "," + audioCodecs
+		}
+
+		attrs = append(attrs, fmt.Sprintf("CODECS=%q", codecs))
+
+		if r.Width > 0 && r.Height > 0 {
+			attrs = append(attrs, fmt.Sprintf("RESOLUTION=%dx%d", r.Width, r.Height))
+		}
+
+		if len(audio) > 0 {
+			attrs = append(attrs, "AUDIO=\"audio\"")
+		}
+
+		fmt.Fprintf(b, "#EXT-X-STREAM-INF:%s\n", strings.Join(attrs, ","))
+		fmt.Fprintln(b, segmentURI(playlist, r.Id, 0))
+	}
+
+	return b.Flush()
+}
+
+// seconds converts a duration in the timescale of the representation to seconds
+func (r *Representation) seconds(d uint64) float64 {
+	if r.Timescale == 0 {
+		return 0
+	}
+	return float64(d) / float64(r.Timescale)
+}
+
+// segmentURI replaces $RepresentationID$ and $Number$ in a URI template
+func segmentURI(template, id string, number int) string {
+	return strings.NewReplacer("$RepresentationID$", id, "$Number$", strconv.Itoa(number)).Replace(template)
+}
@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestByteRangePlaylist checks that the byte ranges of the playlists of the test medias are the
+// initialization and media segments of the representation files
+func TestByteRangePlaylist(t *testing.T) {
+	for name, src := range testMedias(t) {
+		for _, r := range segmentMedia(t, src, FragmentPerTrack).Representations {
+			var b bytes.Buffer
+
+			if err := r.WriteByteRangePlaylist(&b, "$RepresentationID$.mp4"); err != nil {
+				t.Fatal(name, err)
+			}
+
+			data, err := ioutil.ReadAll(r.Reader())
+			if err != nil {
+				t.Fatal(name, err)
+			}
+
+			var end int64
+			var segments int
+
+			uri := r.Id + ".mp4"
+
+			for s := bufio.NewScanner(&b); s.Scan(); {
+				var size, offset int64
+				var box string
+
+				line := s.Text()
+
+				switch {
+				case strings.HasPrefix(line, "#EXT-X-MAP:"):
+					if line != fmt.Sprintf("#EXT-X-MAP:URI=%q,BYTERANGE=\"%d@0\"", uri, len(r.Init)) {
+						t.Fatalf("%s: representation %s: unexpected %s", name, r.Id, line)
+					}
+					size, box = int64(len(r.Init)), "ftyp"
+				case strings.HasPrefix(line, "#EXT-X-BYTERANGE:"):
+					if _, err = fmt.Sscanf(line, "#EXT-X-BYTERANGE:%d@%d", &size, &offset); err != nil {
+						t.Fatal(name, err)
+					}
+					if !s.Scan() || s.Text() != uri {
+						t.Fatalf("%s: representation %s: the byte range isn't followed by the URI", name, r.Id)
+					}
+					segments++
+					box = "styp"
+				default:
+					continue
+				}
+
+				// The ranges follow each other, each one beginning with a box of the segment
+				if offset != end || offset+size > int64(len(data)) || string(data[offset+4:offset+8]) != box {
+					t.Fatalf("%s: representation %s: invalid byte range %d@%d", name, r.Id, size, offset)
+				}
+
+				end = offset + size
+			}
+
+			if segments != len(r.Segments) || end != int64(len(data)) {
+				t.Fatalf("%s: representation %s: the byte ranges don't cover the file", name, r.Id)
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package filter
+
+import (
+	"bytes"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+type indexFilter struct {
+	chunkReader
+
+	m    *stream.MP4
+	sidx bool
+	mfra bool
+}
+
+// SegmentIndex returns a filter that adds a segment index box (sidx) before the fragments of a media,
+// decoded with DecodeSeeker or DecodeReaderAt to list all the fragments
+func SegmentIndex(m *stream.MP4) (FilterInterface, error) {
+	if len(m.Fragments) == 0 {
+		return nil, ErrNotFragmented
+	}
+
+	return &indexFilter{
+		m:    m,
+		sidx: true,
+	}, nil
+}
+
+// RandomAccessIndex returns a filter that adds a movie fragment random access box (mfra) at the end of a
+// fragmented media (see stream.ReadRandomAccess)
+func RandomAccessIndex(m *stream.MP4) (FilterInterface, error) {
+	if len(m.Fragments) == 0 {
+		return nil, ErrNotFragmented
+	}
+
+	return &indexFilter{
+		m:    m,
+		mfra: true,
+	}, nil
+}
+
+func (f *indexFilter) Filter() (err error) {
+	var head, boxes []stream.Box
+	var sidx *stream.SidxBox
+
+	if f.sidx {
+		if sidx, err = f.segmentIndex(); err != nil {
+			return
+		}
+	}
+
+	if f.sidx {
+		f.m.AddBrands(stream.BrandDash)
+	}
+
+	if f.m.Ftyp != nil {
+		head = append(head, f.m.Ftyp)
+	}
+
+	for _, b := range f.m.Boxes() {
+		switch b.Type() {
+		case "mdat", "mfra":
+		case "sidx":
+			if !f.sidx {
+				boxes = append(boxes, b)
+			}
+		default:
+			boxes = append(boxes, b)
+		}
+	}
+
+	head = append(head, f.m.Moov)
+	head = append(head, boxes...)
+
+	if sidx != nil {
+		head = append(head, sidx)
+	}
+
+	// The fragments follow each other, without the boxes which may have been between them
+	var offset int64
+
+	for _, b := range head {
+		offset += int64(b.Size())
+	}
+
+	spans := make([]int64, len(f.m.Fragments))
+	sizes := make([]int64, len(f.m.Fragments))
+
+	for i, fr := range f.m.Fragments {
+		size := int64(fr.Moof.Size())
+		if fr.Mdat != nil {
+			size += int64(fr.Mdat.Size())
+		}
+
+		// The span of the fragment in the source media, as measured by SegmentIndex
+		spans[i] = size
+		if i+1 < len(f.m.Fragments) {
+			spans[i] = f.m.Fragments[i+1].Offset - fr.Offset
+		} else if fr.Mdat != nil {
+			spans[i] = fr.Mdat.Offset + int64(fr.Mdat.Size()) - fr.Offset
+		}
+
+		sizes[i] = size
+	}
+
+	if sidx != nil {
+		resizeReferences(sidx, spans, sizes)
+	}
+
+	for _, fr := range f.m.Fragments {
+		size := int64(fr.Moof.Size())
+		if fr.Mdat != nil {
+			size += int64(fr.Mdat.Size())
+		}
+
+		// Explicit base data offsets move with the fragment
+		for _, traf := range fr.Moof.Traf {
+			if traf.Tfhd != nil && traf.Tfhd.Has(stream.TfhdBaseDataOffsetPresent) {
+				traf.Tfhd.BaseDataOffset = uint64(int64(traf.Tfhd.BaseDataOffset) - fr.Offset + offset)
+			}
+		}
+
+		fr.Offset = offset
+		offset += size
+	}
+
+	// Prepare blob with ftyp, moov and other small atoms
+	buffer := &bytes.Buffer{}
+
+	for _, b := range head {
+		if err = b.Encode(buffer); err != nil {
+			return
+		}
+	}
+
+	f.addData(buffer.Bytes())
+
+	for _, fr := range f.m.Fragments {
+		buffer = &bytes.Buffer{}
+
+		if err = fr.Moof.Encode(buffer); err != nil {
+			return
+		}
+
+		if fr.Mdat != nil {
+			if err = fr.Mdat.EncodeHeader(buffer); err != nil {
+				return
+			}
+		}
+
+		f.addData(buffer.Bytes())
+
+		if fr.Mdat != nil {
+			f.addChunk(fr.Mdat.Offset+int64(fr.Mdat.HeaderSize()), int64(fr.Mdat.ContentSize))
+
+			if f.reader == nil {
+				f.reader = fr.Mdat.Reader()
+			}
+		}
+	}
+
+	// The random access box refers to the new fragment offsets
+	if f.mfra {
+		var mfra *stream.MfraBox
+
+		if mfra, err = f.m.RandomAccessIndex(); err != nil {
+			return
+		}
+
+		buffer = &bytes.Buffer{}
+
+		if err = mfra.Encode(buffer); err != nil {
+			return
+		}
+
+		f.addData(buffer.Bytes())
+	}
+
+	f.m = nil
+
+	return
+}
+
+// segmentIndex computes the segment index of the first video track, or of the first track
+func (f *indexFilter) segmentIndex() (*stream.SidxBox, error) {
+	if len(f.m.Moov.Trak) == 0 {
+		return nil, stream.ErrTrackNotFound
+	}
+
+	ref := f.m.Moov.Trak[0]
+	for _, t := range f.m.Moov.Trak {
+		if t.Kind() == stream.TrackVideo {
+			ref = t
+			break
+		}
+	}
+
+	return f.m.SegmentIndex(ref.Tkhd.TrackId)
+}
+
+// resizeReferences sets the sizes of the subsegments of a segment index from the former and new sizes of
+// the fragments
+func resizeReferences(sidx *stream.SidxBox, spans, sizes []int64) {
+	j := 0
+
+	for i := range sidx.References {
+		r := &sidx.References[i]
+		last := i == len(sidx.References)-1
+
+		var span, size int64
+
+		for ; j < len(spans) && (span < int64(r.ReferencedSize) || last); j++ {
+			span += spans[j]
+			size += sizes[j]
+		}
+
+		r.ReferencedSize = uint32(size)
+	}
+}
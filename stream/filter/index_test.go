@@ -0,0 +1,125 @@
+package filter
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// fragmentedMedias returns the fragmented test media of the stream package, and the test medias
+// fragmented in both modes
+func fragmentedMedias(t *testing.T) map[string][]byte {
+	name := filepath.Join("..", "testdata", "fragmented.mp4")
+
+	src, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{name: src}
+
+	for name, src := range testMedias(t) {
+		for _, mode := range []FragmentMode{FragmentCombined, FragmentPerTrack} {
+			files[fmt.Sprintf("%s (mode %d)", name, mode)] = filterMedia(t, src, fragmenter(time.Second, mode))
+		}
+	}
+
+	return files
+}
+
+// TestSegmentIndex adds a segment index to fragmented medias, and checks that its references are the
+// fragments
+func TestSegmentIndex(t *testing.T) {
+	for name, src := range fragmentedMedias(t) {
+		out := filterMedia(t, src, SegmentIndex)
+
+		m, err := stream.DecodeSeeker(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		var sidx *stream.SidxBox
+		var end int64
+
+		for _, b := range m.Children() {
+			end += int64(b.Size())
+			if sidx, _ = b.(*stream.SidxBox); sidx != nil {
+				break
+			}
+		}
+
+		if sidx == nil || len(sidx.References) == 0 || !m.Ftyp.HasBrand(stream.BrandDash) {
+			t.Fatalf("%s: no segment index", name)
+		}
+
+		// The references follow the segment index, up to the end of the file
+		var size int64
+		for _, r := range sidx.References {
+			size += int64(r.ReferencedSize)
+		}
+
+		first := m.Fragments[0].Offset
+		if end+int64(sidx.FirstOffset) != first || size != int64(len(out))-first {
+			t.Fatalf("%s: the references of the segment index don't cover the fragments", name)
+		}
+
+		checkSamples(t, name, demuxSamples(t, out), demuxSamples(t, src))
+	}
+}
+
+// TestRandomAccessIndex adds a random access index to fragmented medias, and checks that its entries are
+// the first sync samples of the tracks in each fragment
+func TestRandomAccessIndex(t *testing.T) {
+	for name, src := range fragmentedMedias(t) {
+		out := filterMedia(t, src, RandomAccessIndex)
+
+		mfra, err := stream.ReadRandomAccess(bytes.NewReader(out), int64(len(out)))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		m, err := stream.DecodeSeeker(bytes.NewReader(out))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		if len(mfra.Tfra) != len(m.Moov.Trak) {
+			t.Fatalf("%s: got %d track fragment random access boxes, want %d", name, len(mfra.Tfra), len(m.Moov.Trak))
+		}
+
+		for i, trak := range m.Moov.Trak {
+			var want []stream.TfraEntry
+
+			// The first sync sample of the track in each fragment
+			it := m.Samples(trak)
+			for it.Next() {
+				s := it.Sample()
+
+				for _, f := range m.Fragments {
+					if s.Offset < f.Mdat.Offset || s.Offset >= f.Mdat.Offset+int64(f.Mdat.Size()) {
+						continue
+					}
+					if n := len(want); s.IsSync && (n == 0 || want[n-1].MoofOffset != uint64(f.Offset)) {
+						want = append(want, stream.TfraEntry{Time: uint64(s.PTS), MoofOffset: uint64(f.Offset)})
+					}
+				}
+			}
+
+			tfra := mfra.Tfra[i]
+			if tfra.TrackId != trak.Tkhd.TrackId || len(tfra.Entries) != len(want) {
+				t.Fatalf("%s: track %d: got %d entries, want %d", name, trak.Tkhd.TrackId, len(tfra.Entries), len(want))
+			}
+
+			for j, e := range tfra.Entries {
+				if e.Time != want[j].Time || e.MoofOffset != want[j].MoofOffset || string(out[e.MoofOffset+4:e.MoofOffset+8]) != "moof" {
+					t.Fatalf("%s: track %d: entry %d refers to %d at %d, want %d at %d", name, trak.Tkhd.TrackId, j, e.Time, e.MoofOffset, want[j].Time, want[j].MoofOffset)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package filter
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// A part of the filtered media: a range of the source media (oldOffset), or some data held in
+// memory (boxes encoded by the filter)
+type chunk struct {
+	size      int64
+	oldOffset int64
+	newOffset int64
+	data      []byte
+}
+
+// chunkReader reads the filtered media, as a list of chunks sorted by new offset (read from reader,
+// seeking when it is seekable)
+type chunkReader struct {
+	firstChunk int
+
+	size   int64
+	offset int64
+
+	chunks []chunk
+	reader io.Reader
+}
+
+// addData appends a chunk held in memory
+func (f *chunkReader) addData(data []byte) {
+	f.chunks = append(f.chunks, chunk{
+		size:      int64(len(data)),
+		newOffset: f.size,
+		data:      data,
+	})
+	f.size += int64(len(data))
+}
+
+// addChunk appends a chunk read from the source media, merged with the previous one when they
+// follow each other in the source media
+func (f *chunkReader) addChunk(oldOffset, size int64) {
+	if n := len(f.chunks); n > 0 && f.chunks[n-1].data == nil && f.chunks[n-1].oldOffset+f.chunks[n-1].size == oldOffset {
+		f.chunks[n-1].size += size
+		f.size += size
+		return
+	}
+
+	f.chunks = append(f.chunks, chunk{
+		size:      size,
+		oldOffset: oldOffset,
+		newOffset: f.size,
+	})
+	f.size += size
+}
+
+func (f *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	noffset := f.offset
+
+	if whence == os.SEEK_END {
+		noffset = f.size + offset
+	} else if whence == os.SEEK_SET {
+		noffset = offset
+	} else if whence == os.SEEK_CUR {
+		noffset += offset
+	} else {
+		return -1, syscall.EINVAL
+	}
+
+	if noffset < 0 {
+		return -1, syscall.EINVAL
+	}
+
+	if noffset > f.size {
+		return -1, syscall.EINVAL
+	}
+
+	// Going backward, chunks are searched from the beginning
+	if noffset < f.offset {
+		f.firstChunk = 0
+	}
+
+	f.offset = noffset
+
+	return noffset, nil
+}
+
+func (f *chunkReader) Read(buf []byte) (n int, err error) {
+	var nn int
+
+	if len(buf) == 0 {
+		return
+	}
+
+	s, seekable := f.reader.(io.ReadSeeker)
+
+	for f.firstChunk < len(f.chunks) && err == nil && len(buf) > 0 {
+		c := f.chunks[f.firstChunk]
+
+		if f.offset >= c.newOffset+c.size {
+			f.firstChunk++
+			continue
+		}
+
+		if c.data != nil {
+			nn = copy(buf, c.data[f.offset-c.newOffset:])
+			f.offset += int64(nn)
+			n += nn
+			buf = buf[nn:]
+			continue
+		}
+
+		realOffset := c.oldOffset + (f.offset - c.newOffset)
+		if seekable {
+			if _, err = s.Seek(realOffset, os.SEEK_SET); err != nil {
+				return
+			}
+		}
+
+		can := int(c.size - (f.offset - c.newOffset))
+
+		if can > len(buf) {
+			can = len(buf)
+		}
+
+		nn, err = io.ReadFull(f.reader, buf[:can])
+		f.offset += int64(nn)
+		n += nn
+		buf = buf[nn:]
+
+		if nn != can {
+			if err == nil || err == io.EOF || err == io.ErrUnexpectedEOF {
+				err = ErrTruncatedChunk
+			}
+		}
+	}
+
+	if n == 0 && err == nil && f.offset >= f.size {
+		err = io.EOF
+	}
+
+	return
+}
+
+// WriteTo writes the whole filtered media, whatever the current offset
+func (f *chunkReader) WriteTo(w io.Writer) (n int64, err error) {
+	var nn int
+	var nnn int64
+
+	s, seekable := f.reader.(io.Seeker)
+
+	for _, c := range f.chunks {
+		if c.data != nil {
+			nn, err = w.Write(c.data)
+			n += int64(nn)
+			if err != nil {
+				return
+			}
+			continue
+		}
+
+		if seekable {
+			if _, err = s.Seek(c.oldOffset, os.SEEK_SET); err != nil {
+				return
+			}
+		}
+
+		nnn, err = io.CopyN(w, f.reader, c.size)
+		n += nnn
+
+		if nnn != c.size && (err == nil || err == io.EOF) {
+			err = ErrTruncatedChunk
+		}
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// WriteToN writes size bytes of the filtered media from the current offset
+func (f *chunkReader) WriteToN(dst io.Writer, size int64) (n int64, err error) {
+	var nn int
+	var nnn int64
+
+	if size == 0 {
+		return
+	}
+
+	s, seekable := f.reader.(io.ReadSeeker)
+
+	for f.firstChunk < len(f.chunks) && err == nil && n < size {
+		c := f.chunks[f.firstChunk]
+
+		if f.offset >= c.newOffset+c.size {
+			f.firstChunk++
+			continue
+		}
+
+		can := c.size - (f.offset - c.newOffset)
+
+		if can > size-n {
+			can = size - n
+		}
+
+		if c.data != nil {
+			start := f.offset - c.newOffset
+			nn, err = dst.Write(c.data[start : start+can])
+			f.offset += int64(nn)
+			n += int64(nn)
+			continue
+		}
+
+		realOffset := c.oldOffset + (f.offset - c.newOffset)
+
+		if seekable {
+			if _, err = s.Seek(realOffset, os.SEEK_SET); err != nil {
+				return
+			}
+		}
+
+		nnn, err = io.CopyN(dst, f.reader, can)
+		f.offset += nnn
+		n += nnn
+
+		if nnn != can && (err == nil || err == io.EOF) {
+			err = ErrTruncatedChunk
+		}
+	}
+
+	return
+}
+
+// compactChunks merges the chunks following each other in the source media, chunks being placed
+// from the start offset
+func (f *chunkReader) compactChunks(start int64) {
+	if len(f.chunks) == 0 {
+		return
+	}
+
+	newChunks := make([]chunk, 0, 4)
+	last := f.chunks[0]
+	last.newOffset = start
+	lastBound := last.oldOffset + last.size
+	for i := 1; i < len(f.chunks); i++ {
+		ch := f.chunks[i]
+		if lastBound == ch.oldOffset {
+			lastBound += ch.size
+			last.size += ch.size
+		} else {
+			newChunks = append(newChunks, last)
+			ch.newOffset = last.newOffset + last.size
+			last = ch
+			lastBound = ch.oldOffset + ch.size
+		}
+	}
+	newChunks = append(newChunks, last)
+	f.chunks = newChunks
+}
@@ -0,0 +1,319 @@
+package filter
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seifer/go-mp4/stream"
+)
+
+// A Presentation is a media split into segments, for adaptive streaming (DASH, HLS)
+type Presentation struct {
+	Duration        time.Duration
+	Representations []*Representation
+}
+
+// A Representation is an initialization segment and media segments holding some tracks, times being in
+// the timescale of the first track
+type Representation struct {
+	Id        string
+	Kind      stream.TrackKind
+	Codecs    string
+	Bandwidth uint64
+
+	Width, Height uint16
+	SampleRate    uint32
+	Channels      uint16
+
+	Timescale uint32
+	Init      []byte
+	Segments  []*MediaSegment
+}
+
+// A media segment of a representation, Offset being its position in Representation.Reader
+type MediaSegment struct {
+	Number   int
+	Time     uint64
+	Duration uint64
+	Offset   int64
+	Size     int64
+
+	data chunkReader
+}
+
+// Segment splits a media into segments of about duration, beginning on a key frame of the first video
+// track, with a representation per track (FragmentPerTrack) or for all the tracks (FragmentCombined)
+func Segment(m *stream.MP4, duration time.Duration, mode FragmentMode) (*Presentation, error) {
+	if m.Mdat == nil || len(m.Fragments) > 0 {
+		return nil, ErrFragmented
+	}
+
+	if duration <= 0 {
+		return nil, ErrInvalidDuration
+	}
+
+	if err := checkTracks(m); err != nil {
+		return nil, err
+	}
+
+	tracks, err := fragmentTracks(m)
+	if err != nil {
+		return nil, err
+	}
+
+	splitTracks(tracks, duration)
+
+	p := &Presentation{
+		Duration: m.Duration(),
+	}
+
+	groups := [][]*fragmentTrack{tracks}
+
+	if mode == FragmentPerTrack {
+		groups = groups[:0]
+		for _, ft := range tracks {
+			groups = append(groups, []*fragmentTrack{ft})
+		}
+	}
+
+	for _, g := range groups {
+		if len(g) == 0 {
+			continue
+		}
+
+		r, err := newRepresentation(m, g)
+		if err != nil {
+			return nil, err
+		}
+
+		p.Representations = append(p.Representations, r)
+	}
+
+	return p, nil
+}
+
+// newRepresentation returns the representation of some tracks
+func newRepresentation(m *stream.MP4, tracks []*fragmentTrack) (r *Representation, err error) {
+	var ids, codecs []string
+
+	r = &Representation{
+		Kind:      tracks[0].trak.Kind(),
+		Timescale: tracks[0].trak.Mdia.Mdhd.Timescale,
+	}
+
+	for _, ft := range tracks {
+		ids = append(ids, strconv.FormatUint(uint64(ft.trak.Tkhd.TrackId), 10))
+		codecs = append(codecs, ft.trak.Codec())
+
+		if ft.trak.Kind() == stream.TrackVideo {
+			r.Kind = stream.TrackVideo
+		}
+
+		stsd := ft.trak.Mdia.Minf.Stbl.Stsd
+		if stsd == nil || len(stsd.Entries) == 0 {
+			continue
+		}
+
+		switch e := stsd.Entries[0].(type) {
+		case *stream.VisualSampleEntry:
+			if r.Width == 0 {
+				r.Width, r.Height = e.Width, e.Height
+			}
+		case *stream.AudioSampleEntry:
+			if r.SampleRate == 0 {
+				r.SampleRate = uint32(e.SampleRate >> 16)
+				if r.SampleRate == 0 {
+					r.SampleRate = ft.trak.Mdia.Mdhd.Timescale
+				}
+				r.Channels = e.ChannelCount
+			}
+		}
+	}
+
+	r.Id = strings.Join(ids, "_")
+	r.Codecs = strings.Join(codecs, ",")
+
+	// The initialization segment
+	traks := make([]*stream.TrakBox, 0, len(tracks))
+
+	for _, ft := range tracks {
+		if err = ft.removeSamples(); err != nil {
+			return
+		}
+		traks = append(traks, ft.trak)
+	}
+
+	moov := &stream.MoovBox{
+		Mvhd: m.Moov.Mvhd,
+		Trak: traks,
+	}
+
+	if moov.Mvex, err = newMvex(m.Moov.Mvhd.Duration, tracks); err != nil {
+		return
+	}
+
+	buffer := &bytes.Buffer{}
+
+	ftyp := stream.NewFtyp(stream.BrandIso6, 0, stream.BrandIso6, stream.BrandCmfc, stream.BrandDash, stream.BrandMp41)
+
+	if err = ftyp.Encode(buffer); err != nil {
+		return
+	}
+
+	if err = moov.Encode(buffer); err != nil {
+		return
+	}
+
+	r.Init = buffer.Bytes()
+
+	// The media segments
+	fragments := 0
+	for _, ft := range tracks {
+		if len(ft.bounds)-1 > fragments {
+			fragments = len(ft.bounds) - 1
+		}
+	}
+
+	offset := int64(len(r.Init))
+
+	for i := 0; i < fragments; i++ {
+		var s *MediaSegment
+
+		if s, err = newMediaSegment(m, i, tracks); err != nil {
+			return
+		}
+
+		if s == nil {
+			continue
+		}
+
+		s.Number = len(r.Segments) + 1
+		s.Offset = offset
+		offset += s.Size
+
+		if s.Duration > 0 {
+			if b := uint64(s.Size) * 8 * uint64(r.Timescale) / s.Duration; b > r.Bandwidth {
+				r.Bandwidth = b
+			}
+		}
+
+		r.Segments = append(r.Segments, s)
+	}
+
+	return
+}
+
+// newMediaSegment returns the media segment of the fragment i of some tracks, or nil when the tracks have
+// no sample in this fragment
+func newMediaSegment(m *stream.MP4, i int, tracks []*fragmentTrack) (s *MediaSegment, err error) {
+	var ref *fragmentTrack
+
+	for _, ft := range tracks {
+		if ft.fragmentSamples(i) != nil {
+			ref = ft
+			break
+		}
+	}
+
+	if ref == nil {
+		return
+	}
+
+	samples := ref.fragmentSamples(i)
+
+	s = &MediaSegment{}
+
+	pts := samples[0].PTS
+
+	for _, smp := range samples {
+		if smp.PTS < pts {
+			pts = smp.PTS
+		}
+		s.Duration += uint64(smp.Duration)
+	}
+
+	if pts > 0 {
+		s.Time = uint64(pts)
+	}
+
+	moof, mdat, err := buildFragment(uint32(i+1), i, tracks)
+	if err != nil {
+		return nil, err
+	}
+
+	// The segment index refers to the first track having samples, its timescale is the
+	// representation timescale only when it is the first track
+	sidx := &stream.SidxBox{
+		ReferenceId:              ref.trak.Tkhd.TrackId,
+		Timescale:                ref.trak.Mdia.Mdhd.Timescale,
+		EarliestPresentationTime: s.Time,
+		References: []stream.SidxReference{{
+			ReferencedSize:     uint32(moof.Size() + mdat.Size()),
+			SubsegmentDuration: uint32(s.Duration),
+			StartsWithSAP:      samples[0].IsSync,
+		}},
+	}
+
+	if samples[0].IsSync {
+		sidx.References[0].SAPType = 1
+	}
+
+	if ref != tracks[0] {
+		s.Time = stream.RescaleUnits(s.Time, sidx.Timescale, tracks[0].trak.Mdia.Mdhd.Timescale)
+		s.Duration = stream.RescaleUnits(s.Duration, sidx.Timescale, tracks[0].trak.Mdia.Mdhd.Timescale)
+	}
+
+	buffer := &bytes.Buffer{}
+
+	styp := stream.NewStyp(stream.BrandMsdh, 0, stream.BrandMsdh, stream.BrandMsix)
+
+	for _, b := range []stream.Box{styp, sidx, moof} {
+		if err = b.Encode(buffer); err != nil {
+			return
+		}
+	}
+
+	if err = mdat.EncodeHeader(buffer); err != nil {
+		return
+	}
+
+	s.data.addData(buffer.Bytes())
+	s.data.addSamples(i, tracks)
+	s.data.reader = m.Mdat.Reader()
+	s.Size = s.data.size
+
+	return
+}
+
+// Reader returns a reader of the whole representation, as a single file: the initialization segment
+// followed by all the media segments
+func (r *Representation) Reader() io.ReadSeeker {
+	f := &chunkReader{}
+
+	f.addData(r.Init)
+
+	for _, s := range r.Segments {
+		for _, c := range s.data.chunks {
+			if c.data != nil {
+				f.addData(c.data)
+			} else {
+				f.addChunk(c.oldOffset, c.size)
+			}
+		}
+		f.reader = s.data.reader
+	}
+
+	return f
+}
+
+// Reader returns a reader of the media segment
+func (s *MediaSegment) Reader() io.ReadSeeker {
+	return &chunkReader{
+		size:   s.data.size,
+		chunks: s.data.chunks,
+		reader: s.data.reader,
+	}
+}
@@ -0,0 +1,131 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// boxBytes returns a box of type ht holding content
+func boxBytes(ht string, content ...[]byte) []byte {
+	b := make([]byte, BoxHeaderSize)
+	copy(b[4:], ht)
+
+	for _, c := range content {
+		b = append(b, c...)
+	}
+
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+
+	return b
+}
+
+// be returns the big endian encoding of 32 bits values
+func be(v ...uint32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(b[4*i:], x)
+	}
+	return b
+}
+
+// TestDecodeFragments decodes the movie fragments of a fragmented media
+func TestDecodeFragments(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "fragmented.mp4")]
+	if src == nil {
+		t.Fatal("no test media")
+	}
+
+	m, err := DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Moov.Mvex == nil || len(m.Moov.Mvex.Trex) != 2 {
+		t.Fatal("the movie extends box doesn't list the tracks")
+	}
+
+	if len(m.Fragments) != 4 {
+		t.Fatalf("got %d fragments, want 4", len(m.Fragments))
+	}
+
+	samples := map[uint32]int{}
+
+	for i, f := range m.Fragments {
+		if string(src[f.Offset+4:f.Offset+8]) != "moof" || f.Mdat == nil || f.Moof.Mfhd.SequenceNumber != uint32(i+1) {
+			t.Fatalf("fragment %d: invalid moof or mdat box", i)
+		}
+
+		if len(f.Moof.Traf) != 2 {
+			t.Fatalf("fragment %d: got %d track fragments, want 2", i, len(f.Moof.Traf))
+		}
+
+		for j, traf := range f.Moof.Traf {
+			if traf.Tfhd.TrackId != uint32(j+1) || traf.Tfdt == nil || len(traf.Trun) == 0 {
+				t.Fatalf("fragment %d: invalid track fragment %d", i, j)
+			}
+
+			// The video track has 25 frames per second in a timescale of 90000, and B-frames
+			if j == 0 && (traf.Tfdt.BaseMediaDecodeTime != uint64(i)*90000 || !traf.Trun[0].Has(TrunSampleCompositionTimeOffsetPresent)) {
+				t.Fatalf("fragment %d: invalid video track fragment", i)
+			}
+
+			for _, trun := range traf.Trun {
+				samples[traf.Tfhd.TrackId] += len(trun.Samples)
+
+				// The data is in the mdat box of the fragment
+				data := f.Offset + int64(trun.DataOffset)
+				if !trun.Has(TrunDataOffsetPresent) || data < f.Mdat.Offset || data >= f.Mdat.Offset+int64(f.Mdat.Size()) {
+					t.Fatalf("fragment %d: the track run of track %d is outside the media data", i, j+1)
+				}
+			}
+		}
+	}
+
+	if samples[1] != 100 || samples[2] != 87 {
+		t.Fatalf("got %d video and %d audio samples, want 100 and 87", samples[1], samples[2])
+	}
+}
+
+// TestEncodeFragmentBoxes decodes and encodes track fragment headers and track runs having all the optional
+// fields
+func TestEncodeFragmentBoxes(t *testing.T) {
+	tfhd := boxBytes("tfhd", []byte{0, 2, 0, 0x3b}, be(7, 1, 0x1000, 2, 1024, 300, SampleFlagIsNonSync))
+	trun := boxBytes("trun", []byte{1, 0, 0x0f, 0x05}, be(2, 0xfffffff8, SampleFlagDependsOnNoOthers),
+		be(1024, 100, 0, 0xfffffffd), be(512, 200, SampleFlagIsNonSync, 6))
+
+	b, err := DecodeTfhd(bytes.NewReader(tfhd[BoxHeaderSize:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := b.(*TfhdBox)
+
+	if h.TrackId != 7 || h.BaseDataOffset != 1<<32|0x1000 || h.SampleDescriptionIndex != 2 || h.DefaultSampleDuration != 1024 ||
+		h.DefaultSampleSize != 300 || h.DefaultSampleFlags != SampleFlagIsNonSync || !h.Has(TfhdDefaultBaseIsMoof) {
+		t.Fatalf("invalid track fragment header %+v", h)
+	}
+
+	if b, err = DecodeTrun(bytes.NewReader(trun[BoxHeaderSize:])); err != nil {
+		t.Fatal(err)
+	}
+
+	r := b.(*TrunBox)
+
+	if r.DataOffset != -8 || r.FirstSampleFlags != SampleFlagDependsOnNoOthers || len(r.Samples) != 2 ||
+		r.Samples[0] != (TrunSample{1024, 100, 0, -3}) || r.Samples[1] != (TrunSample{512, 200, SampleFlagIsNonSync, 6}) {
+		t.Fatalf("invalid track run %+v", r)
+	}
+
+	for _, test := range []struct {
+		box  Box
+		want []byte
+	}{{h, tfhd}, {r, trun}} {
+		var buf bytes.Buffer
+
+		if err = test.box.Encode(&buf); err != nil || !bytes.Equal(buf.Bytes(), test.want) {
+			t.Errorf("the encoded %s box differs from the decoded one", test.box.Type())
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Some brands of file type and segment type boxes
+const (
+	BrandIsom = "isom" // ISO base media file format
+	BrandIso2 = "iso2"
+	BrandIso6 = "iso6" // ISO base media file format, with movie fragment features (tfdt, signed composition offsets, ...)
+	BrandMp41 = "mp41" // MP4 version 1
+	BrandMp42 = "mp42" // MP4 version 2
+	BrandAvc1 = "avc1" // H.264 tracks
+	BrandCmfc = "cmfc" // CMAF track
+	BrandDash = "dash" // DASH segments
+	BrandMsdh = "msdh" // DASH media segment
+	BrandMsix = "msix" // DASH indexed media segment
+)
+
+// File Type Box (ftyp - mandatory) and Segment Type Box (styp - optional)
+//
+// Status: decoded
+//
+// The ftyp box is the first box of a media: it gives the specifications the media complies with (the
+// major brand and the compatible brands). The styp box has the same layout, and begins a media segment.
+//
+// Brands are four characters codes.
+type FtypBox struct {
+	name             string
+	MajorBrand       string
+	MinorVersion     uint32
+	CompatibleBrands []string
+}
+
+// NewFtyp returns a file type box
+func NewFtyp(major string, minor uint32, compatible ...string) *FtypBox {
+	return &FtypBox{
+		name:             "ftyp",
+		MajorBrand:       major,
+		MinorVersion:     minor,
+		CompatibleBrands: compatible,
+	}
+}
+
+// NewStyp returns a segment type box
+func NewStyp(major string, minor uint32, compatible ...string) *FtypBox {
+	b := NewFtyp(major, minor, compatible...)
+	b.name = "styp"
+	return b
+}
+
+func DecodeFtyp(r io.Reader) (Box, error) {
+	return decodeFileType(r, "ftyp")
+}
+
+func DecodeStyp(r io.Reader) (Box, error) {
+	return decodeFileType(r, "styp")
+}
+
+func decodeFileType(r io.Reader, name string) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || len(data)%4 != 0 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &FtypBox{
+		name:         name,
+		MajorBrand:   string(data[0:4]),
+		MinorVersion: binary.BigEndian.Uint32(data[4:8]),
+	}
+	for data = data[8:]; len(data) > 0; data = data[4:] {
+		b.CompatibleBrands = append(b.CompatibleBrands, string(data[0:4]))
+	}
+	return b, nil
+}
+
+func (b *FtypBox) Type() string {
+	return b.name
+}
+
+func (b *FtypBox) Size() int {
+	return BoxHeaderSize + 8 + 4*len(b.CompatibleBrands)
+}
+
+// HasBrand tells whether brand is the major brand or a compatible brand
+func (b *FtypBox) HasBrand(brand string) bool {
+	return b.MajorBrand == brand || b.HasCompatibleBrand(brand)
+}
+
+// HasCompatibleBrand tells whether brand is a compatible brand
+func (b *FtypBox) HasCompatibleBrand(brand string) bool {
+	for _, c := range b.CompatibleBrands {
+		if c == brand {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMajorBrand sets the major brand and its version, the major brand being added to the compatible
+// brands too
+func (b *FtypBox) SetMajorBrand(brand string, minor uint32) {
+	b.MajorBrand = brand
+	b.MinorVersion = minor
+	b.AddBrands(brand)
+}
+
+// AddBrands adds compatible brands, unless they are already listed
+func (b *FtypBox) AddBrands(brands ...string) {
+	for _, brand := range brands {
+		if !b.HasCompatibleBrand(brand) {
+			b.CompatibleBrands = append(b.CompatibleBrands, brand)
+		}
+	}
+}
+
+// RemoveBrands removes compatible brands (the major brand is kept)
+func (b *FtypBox) RemoveBrands(brands ...string) {
+	l := b.CompatibleBrands[:0]
+	for _, c := range b.CompatibleBrands {
+		keep := true
+		for _, brand := range brands {
+			if c == brand {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			l = append(l, c)
+		}
+	}
+	b.CompatibleBrands = l
+}
+
+func (b *FtypBox) Dump() {
+	fmt.Printf("File type: major brand %s, minor version %d, compatible brands %v\n", b.MajorBrand, b.MinorVersion, b.CompatibleBrands)
+}
+
+func (b *FtypBox) Encode(w io.Writer) error {
+	buf := make([]byte, b.Size())
+	binary.BigEndian.PutUint32(buf[0:], uint32(len(buf)))
+	copy(buf[4:8], b.Type())
+	copy(buf[8:12], brandBytes(b.MajorBrand))
+	binary.BigEndian.PutUint32(buf[12:], b.MinorVersion)
+	for i, c := range b.CompatibleBrands {
+		copy(buf[16+4*i:], brandBytes(c))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// brandBytes returns a brand as four characters, padded with spaces
+func brandBytes(brand string) []byte {
+	c := []byte("    ")
+	copy(c, brand)
+	return c
+}
+
+// FileType returns the file type box of the media, a new one (isom major brand) being added if needed
+func (m *MP4) FileType() *FtypBox {
+	if m.Ftyp == nil {
+		m.Ftyp = NewFtyp(BrandIsom, 0x200, BrandIsom, BrandIso2, BrandMp41)
+	}
+	return m.Ftyp
+}
+
+// SetMajorBrand sets the major brand of the media (see FtypBox.SetMajorBrand)
+func (m *MP4) SetMajorBrand(brand string, minor uint32) {
+	m.FileType().SetMajorBrand(brand, minor)
+}
+
+// AddBrands adds compatible brands to the media (see FtypBox.AddBrands)
+func (m *MP4) AddBrands(brands ...string) {
+	m.FileType().AddBrands(brands...)
+}
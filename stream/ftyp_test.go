@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestEncodeFtypFirst checks that the ftyp box is encoded first, whatever its position in the decoded media,
+// or when it is added to a media without ftyp box
+func TestEncodeFtypFirst(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+	mdat := findBox(src, "mdat")
+	free := boxBytes("free", []byte("padding"))
+
+	tests := []struct {
+		name       string
+		data, want []byte
+		brands     []string
+	}{
+		{
+			name: "ftyp after a free box",
+			data: append(append([]byte(nil), free...), src...),
+			want: append(append(append([]byte(nil), src[:mdat]...), free...), src[mdat:]...),
+		},
+		{
+			name:   "added ftyp",
+			data:   src[mdat:],
+			want:   append(boxBytes("ftyp", []byte("isom"), be(0x200), []byte("isomiso2mp41dash")), src[mdat:]...),
+			brands: []string{BrandDash},
+		},
+	}
+
+	for _, tt := range tests {
+		m, err := DecodeSeeker(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+
+		if tt.brands != nil {
+			m.AddBrands(tt.brands...)
+		}
+
+		var b bytes.Buffer
+
+		if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), tt.want) {
+			t.Fatalf("%s: the ftyp box isn't encoded first (%v)", tt.name, err)
+		}
+	}
+}
+
+// TestBrands changes the brands of file type and segment type boxes
+func TestBrands(t *testing.T) {
+	for _, ht := range []string{"ftyp", "styp"} {
+		data := boxBytes(ht, []byte("mp42"), be(1), []byte("isommp42avc1"))
+
+		b, err := decodeFileType(bytes.NewReader(data[BoxHeaderSize:]), ht)
+		if err != nil {
+			t.Fatal(ht, err)
+		}
+
+		f := b.(*FtypBox)
+		if f.Type() != ht || f.MajorBrand != BrandMp42 || f.MinorVersion != 1 || !reflect.DeepEqual(f.CompatibleBrands, []string{BrandIsom, BrandMp42, BrandAvc1}) {
+			t.Fatalf("invalid %s box %+v", ht, f)
+		}
+
+		f.SetMajorBrand(BrandIso6, 0)
+		f.RemoveBrands(BrandIsom, BrandAvc1)
+		f.AddBrands(BrandCmfc, BrandIso6)
+
+		if !f.HasBrand(BrandIso6) || f.HasBrand(BrandIsom) || f.HasCompatibleBrand(BrandAvc1) {
+			t.Fatalf("invalid brands of the %s box %+v", ht, f)
+		}
+
+		var buf bytes.Buffer
+
+		if err = f.Encode(&buf); err != nil || !bytes.Equal(buf.Bytes(), boxBytes(ht, []byte("iso6"), be(0), []byte("mp42iso6cmfc"))) {
+			t.Fatalf("unexpected encoded %s box %q", ht, buf.Bytes())
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package stream
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+// FuzzDecode decodes random medias, the medias of testdata being the seed corpus: decoding must fail
+// without panicking, and a decoded media must be encoded and its samples listed.
+func FuzzDecode(f *testing.F) {
+	for _, data := range testFiles(f) {
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := Decode(bytes.NewReader(data)); err != nil {
+			return
+		}
+
+		m, err := DecodeSeeker(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		if err = m.Encode(ioutil.Discard); err != nil {
+			t.Fatal(err)
+		}
+
+		m.Duration()
+
+		// The sample count is checked against the sample table, not against the size of the media
+		const maxSamples = 1 << 16
+
+		for _, trak := range m.Moov.Trak {
+			it := m.Samples(trak)
+			for n := 0; n < maxSamples && it.Next(); n++ {
+				it.Sample()
+			}
+		}
+	})
+}
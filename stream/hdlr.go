@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Handler Reference Box (hdlr - mandatory)
+//
+// Contained in : Media Box (mdia) or Meta Box (meta)
+//
+// Status: decoded
+//
+// The handler type declares the nature of the media (vide, soun, text, subt, hint, meta, tmcd, ...),
+// see TrakBox.Kind. Name is a human readable name of the track type.
+//
+// QuickTime files store a component type in PreDefined (mhlr) and a pascal string as name.
+type HdlrBox struct {
+	Version     byte
+	Flags       [3]byte
+	header      [8]byte
+	PreDefined  uint32
+	HandlerType string
+	Name        string
+	reserved    [12]byte
+	name        []byte
+}
+
+func DecodeHdlr(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 24 {
+		return nil, ErrInvalidBoxSize
+	}
+
+	b := &HdlrBox{
+		Flags:       [3]byte{data[1], data[2], data[3]},
+		Version:     data[0],
+		PreDefined:  binary.BigEndian.Uint32(data[4:8]),
+		HandlerType: string(data[8:12]),
+		name:        data[24:],
+	}
+
+	copy(b.reserved[:], data[12:24])
+
+	b.Name = hdlrName(b.PreDefined, b.name)
+
+	return b, nil
+}
+
+// NewHdlrBox returns a handler reference box
+func NewHdlrBox(handlerType, name string) *HdlrBox {
+	return &HdlrBox{
+		HandlerType: handlerType,
+		Name:        name,
+	}
+}
+
+// hdlrName decodes a null terminated name, or a pascal string for QuickTime handlers
+func hdlrName(preDefined uint32, name []byte) string {
+	if preDefined != 0 && len(name) > 0 && int(name[0]) == len(name)-1 {
+		name = name[1:]
+	}
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
+
+func (b *HdlrBox) Type() string {
+	return "hdlr"
+}
+
+// nameBytes returns the encoded name, unchanged if Name wasn't modified since decoding
+func (b *HdlrBox) nameBytes() []byte {
+	if b.name != nil && hdlrName(b.PreDefined, b.name) == b.Name {
+		return b.name
+	}
+	return append([]byte(b.Name), 0)
+}
+
+func (b *HdlrBox) Size() int {
+	return BoxHeaderSize + 24 + len(b.nameBytes())
+}
+
+func (b *HdlrBox) Dump() {
+	fmt.Printf("Handler:\n Type: %s\n Name: %s\n", b.HandlerType, b.Name)
+}
+
+func (b *HdlrBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.PreDefined)
+	copy(buf[8:12], b.HandlerType)
+	copy(buf[12:24], b.reserved[:])
+	copy(buf[24:], b.nameBytes())
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// be64 returns the big endian encoding of a 64 bits value
+func be64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// TestHeaderVersions decodes and encodes version 1 movie, track and media headers (64 bits times), and
+// checks that version 0 headers holding times larger than 32 bits are encoded as version 1
+func TestHeaderVersions(t *testing.T) {
+	const created, modified, duration = 1<<33 + 1, 1<<33 + 2, 1 << 40
+
+	times := [][]byte{be64(created), be64(modified)}
+
+	mvhd := boxBytes("mvhd", []byte{1, 0, 0, 0}, bytes.Join(times, nil), be(1000), be64(duration), be(0x10000), []byte{1, 0},
+		make([]byte, 10), unityMatrix(), make([]byte, 24), be(3))
+	tkhd := boxBytes("tkhd", []byte{1, 0, 0, 7}, bytes.Join(times, nil), be(2, 0), be64(duration), make([]byte, 8), be(0, 0x01000000),
+		unityMatrix(), be(640<<16, 480<<16))
+	mdhd := boxBytes("mdhd", []byte{1, 0, 0, 0}, bytes.Join(times, nil), be(90000), be64(duration), []byte{0x55, 0xc4, 0, 0})
+
+	tests := []struct {
+		data   []byte
+		decode BoxDecoder
+		check  func(Box) bool
+	}{
+		{mvhd, DecodeMvhd, func(b Box) bool {
+			h := b.(*MvhdBox)
+			return h.CreationTime == created && h.ModificationTime == modified && h.Timescale == 1000 && h.Duration == duration &&
+				h.Rate == 1<<16 && h.Volume == 1<<8 && h.NextTrackId == 3
+		}},
+		{tkhd, DecodeTkhd, func(b Box) bool {
+			h := b.(*TkhdBox)
+			return h.CreationTime == created && h.ModificationTime == modified && h.TrackId == 2 && h.Duration == duration &&
+				h.Volume == 1<<8 && h.Width == 640<<16 && h.Height == 480<<16
+		}},
+		{mdhd, DecodeMdhd, func(b Box) bool {
+			h := b.(*MdhdBox)
+			return h.CreationTime == created && h.ModificationTime == modified && h.Timescale == 90000 && h.Duration == duration &&
+				h.Language == 0x55c4
+		}},
+	}
+
+	for _, tt := range tests {
+		ht := string(tt.data[4:8])
+
+		b, err := tt.decode(bytes.NewReader(tt.data[BoxHeaderSize:]))
+		if err != nil {
+			t.Fatal(ht, err)
+		}
+
+		if !tt.check(b) {
+			t.Fatalf("invalid %s box %+v", ht, b)
+		}
+
+		var buf bytes.Buffer
+
+		if err = b.Encode(&buf); err != nil || !bytes.Equal(buf.Bytes(), tt.data) {
+			t.Fatalf("the encoded %s box differs from the decoded one", ht)
+		}
+
+		// Set to version 0, the box is still encoded as version 1 while its times don't fit in 32 bits
+		switch h := b.(type) {
+		case *MvhdBox:
+			h.Version = 0
+		case *TkhdBox:
+			h.Version = 0
+		case *MdhdBox:
+			h.Version = 0
+		}
+
+		buf.Reset()
+
+		if err = b.Encode(&buf); err != nil || !bytes.Equal(buf.Bytes(), tt.data) {
+			t.Fatalf("the %s box isn't encoded as version 1", ht)
+		}
+	}
+
+	// Times fitting in 32 bits are encoded as version 0
+	var buf bytes.Buffer
+
+	if err := NewMvhdBox(1000).Encode(&buf); err != nil || buf.Len() != BoxHeaderSize+100 || buf.Bytes()[BoxHeaderSize] != 0 {
+		t.Fatal("the movie header isn't encoded as version 0")
+	}
+}
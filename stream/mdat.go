@@ -1,7 +1,6 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
 )
 
@@ -12,14 +11,29 @@ import (
 // The mdat box contains media chunks/samples.
 //
 // It is not read, only the io.Reader is stored, and will be used to Encode (io.Copy) the box to a io.Writer.
+//
+// Offset is the position of the box (header included) from the beginning of the file. When the media
+// was decoded with DecodeSeeker or DecodeReaderAt, the stored reader is the whole file, and the box
+// content is read from its position on Encode.
+//
+// A box larger than 4GiB is encoded with a 64 bits header (largesize). A box decoded with a size of 0
+// (extending to the end of the file) while its content size can't be known is encoded the same way,
+// and its content is copied up to the end of the reader.
 type MdatBox struct {
-	ContentSize uint32
-	header      [8]byte
+	ContentSize uint64
+	Offset      int64
 	r           io.Reader
+	start       int64
+	seekable    bool
+	largeHeader bool
+	toEOF       bool
 }
 
 func DecodeMdat(r io.Reader) (Box, error) {
-	// r is a LimitedReader
+	// r is the LimitedReader of the box, within a BoxReader
+	if br, ok := r.(*BoxReader); ok {
+		r = br.Reader
+	}
 	if lr, limited := r.(*io.LimitedReader); limited {
 		r = lr.R
 	}
@@ -30,21 +44,52 @@ func (b *MdatBox) Type() string {
 	return "mdat"
 }
 
+// HeaderSize returns the size of the box header (8 bytes, or 16 bytes with a largesize)
+func (b *MdatBox) HeaderSize() int {
+	if b.toEOF {
+		return BoxHeaderSize
+	}
+	if b.largeHeader {
+		return LargeBoxHeaderSize
+	}
+	return boxSize(int(b.ContentSize)) - int(b.ContentSize)
+}
+
 func (b *MdatBox) Size() int {
-	return BoxHeaderSize + int(b.ContentSize)
+	return b.HeaderSize() + int(b.ContentSize)
 }
 
+// Reader returns the reader holding the media data.
+//
+// Chunk offsets are absolute file positions: with a seekable reader, seek to the chunk offset before reading.
 func (b *MdatBox) Reader() io.Reader {
 	return b.r
 }
 
-func (b *MdatBox) Encode(w io.Writer) error {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err := w.Write(b.header[:])
-	if err != nil {
-		return err
+// EncodeHeader writes the box header only
+func (b *MdatBox) EncodeHeader(w io.Writer) error {
+	if b.toEOF {
+		return encodeHeader(w, b.Type(), 0, false)
 	}
-	_, err = io.Copy(w, b.r)
-	return err
+	return encodeHeader(w, b.Type(), b.Size(), b.largeHeader)
+}
+
+func (b *MdatBox) Encode(w io.Writer) (err error) {
+	if err = b.EncodeHeader(w); err != nil {
+		return
+	}
+
+	if b.seekable {
+		if _, err = b.r.(io.Seeker).Seek(b.start, io.SeekStart); err != nil {
+			return
+		}
+	}
+
+	if b.toEOF {
+		_, err = io.Copy(w, b.r)
+	} else {
+		_, err = io.CopyN(w, b.r, int64(b.ContentSize))
+	}
+
+	return
 }
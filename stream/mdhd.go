@@ -4,25 +4,27 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"time"
+	"math"
 )
 
 // Media Header Box (mdhd - mandatory)
 //
 // Contained in : Media Box (mdia)
 //
-// Status : only version 0 is decoded. version 1 is not supported
+// Status : decoded
 //
 // Timescale defines the timescale used for tracks.
 // Language is a ISO-639-2/T language code stored as 1bit padding + [3]int5
+//
+// Times and duration are on 64 bits in version 1 (see MvhdBox).
 type MdhdBox struct {
 	Version          byte
 	Flags            [3]byte
 	header           [8]byte
-	CreationTime     uint32
-	ModificationTime uint32
+	CreationTime     uint64
+	ModificationTime uint64
 	Timescale        uint32
-	Duration         uint32
+	Duration         uint64
 	Language         uint16
 }
 
@@ -31,27 +33,49 @@ func DecodeMdhd(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MdhdBox{
-		Version:          data[0],
-		Flags:            [3]byte{data[1], data[2], data[3]},
-		CreationTime:     binary.BigEndian.Uint32(data[4:8]),
-		ModificationTime: binary.BigEndian.Uint32(data[8:12]),
-		Timescale:        binary.BigEndian.Uint32(data[12:16]),
-		Duration:         binary.BigEndian.Uint32(data[16:20]),
-		Language:         binary.BigEndian.Uint16(data[20:22]),
-	}, nil
+	if len(data) < 22 || data[0] == 1 && len(data) < 34 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &MdhdBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+	}
+	if b.Version == 1 {
+		b.CreationTime = binary.BigEndian.Uint64(data[4:12])
+		b.ModificationTime = binary.BigEndian.Uint64(data[12:20])
+		b.Timescale = binary.BigEndian.Uint32(data[20:24])
+		b.Duration = binary.BigEndian.Uint64(data[24:32])
+		b.Language = binary.BigEndian.Uint16(data[32:34])
+	} else {
+		b.CreationTime = uint64(binary.BigEndian.Uint32(data[4:8]))
+		b.ModificationTime = uint64(binary.BigEndian.Uint32(data[8:12]))
+		b.Timescale = binary.BigEndian.Uint32(data[12:16])
+		b.Duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+		b.Language = binary.BigEndian.Uint16(data[20:22])
+	}
+	return b, nil
 }
 
 func (b *MdhdBox) Type() string {
 	return "mdhd"
 }
 
+func (b *MdhdBox) version() byte {
+	if b.Version == 1 || b.CreationTime > math.MaxUint32 || b.ModificationTime > math.MaxUint32 || b.Duration > math.MaxUint32 {
+		return 1
+	}
+	return 0
+}
+
 func (b *MdhdBox) Size() int {
+	if b.version() == 1 {
+		return BoxHeaderSize + 36
+	}
 	return BoxHeaderSize + 24
 }
 
 func (b *MdhdBox) Dump() {
-	fmt.Printf("Media Header:\n Timescale: %d units/sec\n Duration: %d units (%s)\n", b.Timescale, b.Duration, time.Duration(b.Duration/b.Timescale)*time.Second)
+	fmt.Printf("Media Header:\n Timescale: %d units/sec\n Duration: %d units (%s)\n", b.Timescale, b.Duration, UnitsToDuration(b.Duration, b.Timescale))
 
 }
 
@@ -63,13 +87,21 @@ func (b *MdhdBox) Encode(w io.Writer) error {
 		return err
 	}
 	buf := makebuf(b)
-	buf[0] = b.Version
+	buf[0] = b.version()
 	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
-	binary.BigEndian.PutUint32(buf[4:], b.CreationTime)
-	binary.BigEndian.PutUint32(buf[8:], b.ModificationTime)
-	binary.BigEndian.PutUint32(buf[12:], b.Timescale)
-	binary.BigEndian.PutUint32(buf[16:], b.Duration)
-	binary.BigEndian.PutUint16(buf[20:], b.Language)
+	if buf[0] == 1 {
+		binary.BigEndian.PutUint64(buf[4:], b.CreationTime)
+		binary.BigEndian.PutUint64(buf[12:], b.ModificationTime)
+		binary.BigEndian.PutUint32(buf[20:], b.Timescale)
+		binary.BigEndian.PutUint64(buf[24:], b.Duration)
+		binary.BigEndian.PutUint16(buf[32:], b.Language)
+	} else {
+		binary.BigEndian.PutUint32(buf[4:], uint32(b.CreationTime))
+		binary.BigEndian.PutUint32(buf[8:], uint32(b.ModificationTime))
+		binary.BigEndian.PutUint32(buf[12:], b.Timescale)
+		binary.BigEndian.PutUint32(buf[16:], uint32(b.Duration))
+		binary.BigEndian.PutUint16(buf[20:], b.Language)
+	}
 	_, err = w.Write(buf)
 	return err
 }
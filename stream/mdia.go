@@ -1,7 +1,6 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
 )
 
@@ -13,10 +12,11 @@ import (
 //
 // Contains all information about the media data.
 type MdiaBox struct {
-	Mdhd   *MdhdBox
-	Minf   *MinfBox
-	boxes  []Box
-	header [8]byte
+	Mdhd  *MdhdBox
+	Hdlr  *HdlrBox
+	Minf  *MinfBox
+	boxes []Box
+	order []Box
 }
 
 func DecodeMdia(r io.Reader) (Box, error) {
@@ -24,18 +24,15 @@ func DecodeMdia(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	m := &MdiaBox{
-		boxes: make([]Box, 0, len(l)),
-	}
-	for _, b := range l {
-		switch b.Type() {
-		case "mdhd":
-			m.Mdhd = b.(*MdhdBox)
-		case "minf":
-			m.Minf = b.(*MinfBox)
-		default:
-			m.boxes = append(m.boxes, b)
-		}
+	m := &MdiaBox{}
+	m.SetChildren(l)
+	switch {
+	case m.Mdhd == nil:
+		return nil, missingBox("mdhd")
+	case m.Hdlr == nil:
+		return nil, missingBox("hdlr")
+	case m.Minf == nil:
+		return nil, missingBox("minf")
 	}
 	return m, nil
 }
@@ -44,44 +41,71 @@ func (b *MdiaBox) Type() string {
 	return "mdia"
 }
 
-func (b *MdiaBox) Size() (sz int) {
-	sz += b.Mdhd.Size()
-
-	if b.Minf != nil {
-		sz += b.Minf.Size()
-	}
-
-	for _, box := range b.boxes {
-		sz += box.Size()
-	}
-
-	return sz + BoxHeaderSize
+func (b *MdiaBox) Size() int {
+	return boxSize(boxesSize(b.children()))
 }
 
 func (b *MdiaBox) Dump() {
 	b.Mdhd.Dump()
+	if b.Hdlr != nil {
+		b.Hdlr.Dump()
+	}
 	if b.Minf != nil {
 		b.Minf.Dump()
 	}
 }
 
-func (b *MdiaBox) Encode(w io.Writer) (err error) {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err = w.Write(b.header[:])
-	if err != nil {
-		return
-	}
-	err = b.Mdhd.Encode(w)
-	if err != nil {
-		return
+func (b *MdiaBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
 	}
 
-	for _, b := range b.boxes {
-		if err = b.Encode(w); err != nil {
-			return err
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MdiaBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MdiaBox) SetChildren(l []Box) {
+	b.Mdhd, b.Hdlr, b.Minf, b.boxes = nil, nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *MdhdBox:
+			if b.Mdhd == nil {
+				b.Mdhd = c
+				continue
+			}
+		case *HdlrBox:
+			if b.Hdlr == nil {
+				b.Hdlr = c
+				continue
+			}
+		case *MinfBox:
+			if b.Minf == nil {
+				b.Minf = c
+				continue
+			}
 		}
+		b.boxes = append(b.boxes, c)
 	}
+	b.order = append([]Box{}, l...)
+}
 
-	return b.Minf.Encode(w)
+// children returns the children of the box, in the default order
+func (b *MdiaBox) children() []Box {
+	var l []Box
+	if b.Mdhd != nil {
+		l = append(l, b.Mdhd)
+	}
+	if b.Hdlr != nil {
+		l = append(l, b.Hdlr)
+	}
+	l = append(l, b.boxes...)
+	if b.Minf != nil {
+		l = append(l, b.Minf)
+	}
+	return l
 }
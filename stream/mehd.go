@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Movie Extends Header Box (mehd - optional)
+//
+// Contained in : Movie Extends Box (mvex)
+//
+// Status: decoded
+//
+// FragmentDuration is the duration of the whole fragmented movie (fragments included), in the movie timescale.
+//
+// Version 0 stores the duration on 32 bits, version 1 on 64 bits. Version 1 is encoded when Version is 1
+// or when the duration doesn't fit in 32 bits.
+type MehdBox struct {
+	Version          byte
+	Flags            [3]byte
+	header           [8]byte
+	FragmentDuration uint64
+}
+
+func DecodeMehd(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 || data[0] == 1 && len(data) < 12 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &MehdBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+	}
+	if b.Version == 1 {
+		b.FragmentDuration = binary.BigEndian.Uint64(data[4:12])
+	} else {
+		b.FragmentDuration = uint64(binary.BigEndian.Uint32(data[4:8]))
+	}
+	return b, nil
+}
+
+func (b *MehdBox) Type() string {
+	return "mehd"
+}
+
+func (b *MehdBox) version() byte {
+	if b.Version == 1 || b.FragmentDuration > math.MaxUint32 {
+		return 1
+	}
+	return 0
+}
+
+func (b *MehdBox) Size() int {
+	if b.version() == 1 {
+		return BoxHeaderSize + 12
+	}
+	return BoxHeaderSize + 8
+}
+
+func (b *MehdBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.version()
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	if buf[0] == 1 {
+		binary.BigEndian.PutUint64(buf[4:], b.FragmentDuration)
+	} else {
+		binary.BigEndian.PutUint32(buf[4:], uint32(b.FragmentDuration))
+	}
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,58 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Movie Fragment Header Box (mfhd - mandatory)
+//
+// Contained in : Movie Fragment Box (moof)
+//
+// Status: decoded
+//
+// SequenceNumber numbers the fragments, in increasing order (usually starting at 1).
+type MfhdBox struct {
+	Version        byte
+	Flags          [3]byte
+	header         [8]byte
+	SequenceNumber uint32
+}
+
+func DecodeMfhd(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+	return &MfhdBox{
+		Version:        data[0],
+		Flags:          [3]byte{data[1], data[2], data[3]},
+		SequenceNumber: binary.BigEndian.Uint32(data[4:8]),
+	}, nil
+}
+
+func (b *MfhdBox) Type() string {
+	return "mfhd"
+}
+
+func (b *MfhdBox) Size() int {
+	return BoxHeaderSize + 8
+}
+
+func (b *MfhdBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.SequenceNumber)
+	_, err = w.Write(buf)
+	return err
+}
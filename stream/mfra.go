@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrNoRandomAccess = errors.New("mfra box not found")
+)
+
+// Movie Fragment Random Access Box (mfra - optional)
+//
+// Status: decoded
+//
+// Usually placed at the end of a fragmented media, it lists the sync samples of the tracks (tfra), to
+// seek without reading all the moof boxes. Its last box (mfro) gives its size: ReadRandomAccess finds it
+// by reading the end of the file only.
+type MfraBox struct {
+	Tfra  []*TfraBox
+	Mfro  *MfroBox
+	boxes []Box
+	order []Box
+}
+
+func DecodeMfra(r io.Reader) (Box, error) {
+	l, err := DecodeContainer(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &MfraBox{}
+	m.SetChildren(l)
+	return m, nil
+}
+
+func (b *MfraBox) Type() string {
+	return "mfra"
+}
+
+func (b *MfraBox) Size() int {
+	return boxSize(boxesSize(b.children()))
+}
+
+// TrackRandomAccess returns the random access entries of a track, or nil
+func (b *MfraBox) TrackRandomAccess(trackId uint32) *TfraBox {
+	for _, t := range b.Tfra {
+		if t.TrackId == trackId {
+			return t
+		}
+	}
+	return nil
+}
+
+// Lookup returns the entry of a track whose sync sample is the last one presented at or before a time
+// (in the media timescale of the track), or false when there is none
+func (b *MfraBox) Lookup(trackId uint32, time uint64) (TfraEntry, bool) {
+	if t := b.TrackRandomAccess(trackId); t != nil {
+		return t.Lookup(time)
+	}
+	return TfraEntry{}, false
+}
+
+func (b *MfraBox) Dump() {
+	fmt.Println("Movie Fragment Random Access:")
+	for _, t := range b.Tfra {
+		fmt.Printf(" Track %d : %d entries\n", t.TrackId, len(t.Entries))
+	}
+}
+
+func (b *MfraBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MfraBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MfraBox) SetChildren(l []Box) {
+	b.Tfra, b.Mfro, b.boxes = nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *TfraBox:
+			b.Tfra = append(b.Tfra, c)
+			continue
+		case *MfroBox:
+			if b.Mfro == nil {
+				b.Mfro = c
+				continue
+			}
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *MfraBox) children() []Box {
+	var l []Box
+	for _, c := range b.Tfra {
+		l = append(l, c)
+	}
+	l = append(l, b.boxes...)
+	if b.Mfro != nil {
+		l = append(l, b.Mfro)
+	}
+	return l
+}
+
+// ReadRandomAccess reads the mfra box at the end of a media of the given size, reading only the end of
+// the file: the mfro box first, then the mfra box.
+func ReadRandomAccess(r io.ReaderAt, size int64) (*MfraBox, error) {
+	mfro := make([]byte, BoxHeaderSize+8)
+
+	if size < int64(len(mfro)) {
+		return nil, ErrNoRandomAccess
+	}
+
+	if _, err := r.ReadAt(mfro, size-int64(len(mfro))); err != nil {
+		return nil, err
+	}
+
+	if string(mfro[4:8]) != "mfro" {
+		return nil, ErrNoRandomAccess
+	}
+
+	n := int64(binary.BigEndian.Uint32(mfro[12:16]))
+
+	if n < BoxHeaderSize+int64(len(mfro)) || n > size {
+		return nil, ErrNoRandomAccess
+	}
+
+	data := make([]byte, n)
+
+	if _, err := r.ReadAt(data, size-n); err != nil {
+		return nil, err
+	}
+
+	if string(data[4:8]) != "mfra" || int64(binary.BigEndian.Uint32(data[0:4])) != n {
+		return nil, ErrNoRandomAccess
+	}
+
+	b, err := DecodeMfra(io.LimitReader(bytes.NewReader(data[BoxHeaderSize:]), n-BoxHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.(*MfraBox), nil
+}
+
+// RandomAccessIndex computes the movie fragment random access box (mfra) of a fragmented media: the first
+// sync sample of each track in each fragment, at the fragment offsets.
+func (m *MP4) RandomAccessIndex() (*MfraBox, error) {
+	if len(m.Fragments) == 0 {
+		return nil, ErrNoFragment
+	}
+
+	mfra := &MfraBox{
+		Mfro: &MfroBox{},
+	}
+
+	for _, t := range m.Moov.Trak {
+		tfra := &TfraBox{
+			TrackId: t.Tkhd.TrackId,
+		}
+
+		frag := -1
+
+		it := m.Samples(t)
+		for it.Next() {
+			s := it.Sample()
+
+			// Samples of the sample table, or not the first sync sample of the fragment
+			if it.next <= it.count || !s.IsSync || it.frag == frag {
+				continue
+			}
+
+			frag = it.frag
+
+			e := TfraEntry{
+				MoofOffset:   uint64(m.Fragments[it.frag].Offset),
+				TrafNumber:   uint32(it.traf + 1),
+				TrunNumber:   uint32(it.trun + 1),
+				SampleNumber: uint32(it.sample),
+			}
+
+			if s.PTS > 0 {
+				e.Time = uint64(s.PTS)
+			}
+
+			tfra.Entries = append(tfra.Entries, e)
+		}
+
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+
+		mfra.Tfra = append(mfra.Tfra, tfra)
+	}
+
+	mfra.Mfro.MfraSize = uint32(mfra.Size())
+
+	return mfra, nil
+}
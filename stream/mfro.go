@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Movie Fragment Random Access Offset Box (mfro - mandatory)
+//
+// Contained in : Movie Fragment Random Access Box (mfra)
+//
+// Status: decoded
+//
+// The last box of the mfra box, it gives the size of the mfra box (MfraSize), so that the mfra box can be
+// found by reading the end of the file.
+type MfroBox struct {
+	Version  byte
+	Flags    [3]byte
+	header   [8]byte
+	MfraSize uint32
+}
+
+func DecodeMfro(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+	return &MfroBox{
+		Version:  data[0],
+		Flags:    [3]byte{data[1], data[2], data[3]},
+		MfraSize: binary.BigEndian.Uint32(data[4:8]),
+	}, nil
+}
+
+func (b *MfroBox) Type() string {
+	return "mfro"
+}
+
+func (b *MfroBox) Size() int {
+	return BoxHeaderSize + 8
+}
+
+func (b *MfroBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.MfraSize)
+	_, err = w.Write(buf)
+	return err
+}
@@ -1,7 +1,6 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
 )
 
@@ -11,9 +10,9 @@ import (
 //
 // Status: partially decoded (hmhd - hint tracks - and nmhd - null media - are ignored)
 type MinfBox struct {
-	Stbl   *StblBox
-	boxes  []Box
-	header [8]byte
+	Stbl  *StblBox
+	boxes []Box
+	order []Box
 }
 
 func DecodeMinf(r io.Reader) (Box, error) {
@@ -21,16 +20,10 @@ func DecodeMinf(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	m := &MinfBox{
-		boxes: make([]Box, 0, len(l)),
-	}
-	for _, b := range l {
-		switch b.Type() {
-		case "stbl":
-			m.Stbl = b.(*StblBox)
-		default:
-			m.boxes = append(m.boxes, b)
-		}
+	m := &MinfBox{}
+	m.SetChildren(l)
+	if m.Stbl == nil {
+		return nil, missingBox("stbl")
 	}
 	return m, nil
 }
@@ -39,33 +32,49 @@ func (b *MinfBox) Type() string {
 	return "minf"
 }
 
-func (b *MinfBox) Size() (sz int) {
-	sz += b.Stbl.Size()
-
-	for _, box := range b.boxes {
-		sz += box.Size()
-	}
-
-	return sz + BoxHeaderSize
+func (b *MinfBox) Size() int {
+	return boxSize(boxesSize(b.children()))
 }
 
 func (b *MinfBox) Dump() {
 	b.Stbl.Dump()
 }
 
-func (b *MinfBox) Encode(w io.Writer) (err error) {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err = w.Write(b.header[:])
-	if err != nil {
-		return
+func (b *MinfBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
 	}
 
-	for _, b := range b.boxes {
-		if err = b.Encode(w); err != nil {
-			return
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MinfBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MinfBox) SetChildren(l []Box) {
+	b.Stbl, b.boxes = nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *StblBox:
+			if b.Stbl == nil {
+				b.Stbl = c
+				continue
+			}
 		}
+		b.boxes = append(b.boxes, c)
 	}
+	b.order = append([]Box{}, l...)
+}
 
-	return b.Stbl.Encode(w)
+// children returns the children of the box, in the default order
+func (b *MinfBox) children() []Box {
+	var l []Box
+	l = append(l, b.boxes...)
+	if b.Stbl != nil {
+		l = append(l, b.Stbl)
+	}
+	return l
 }
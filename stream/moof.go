@@ -0,0 +1,81 @@
+package stream
+
+import (
+	"io"
+)
+
+// Movie Fragment Box (moof - optional)
+//
+// Status: decoded
+//
+// A movie fragment extends the presentation in time: it describes samples stored in the following
+// mdat box, track by track (traf). The tracks must be declared in the moov box, with a mvex box.
+type MoofBox struct {
+	Mfhd  *MfhdBox
+	Traf  []*TrafBox
+	boxes []Box
+	order []Box
+}
+
+func DecodeMoof(r io.Reader) (Box, error) {
+	l, err := DecodeContainer(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &MoofBox{}
+	m.SetChildren(l)
+	return m, nil
+}
+
+func (b *MoofBox) Type() string {
+	return "moof"
+}
+
+func (b *MoofBox) Size() int {
+	return boxSize(boxesSize(b.children()))
+}
+
+func (b *MoofBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MoofBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MoofBox) SetChildren(l []Box) {
+	b.Mfhd, b.Traf, b.boxes = nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *MfhdBox:
+			if b.Mfhd == nil {
+				b.Mfhd = c
+				continue
+			}
+		case *TrafBox:
+			b.Traf = append(b.Traf, c)
+			continue
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *MoofBox) children() []Box {
+	var l []Box
+	if b.Mfhd != nil {
+		l = append(l, b.Mfhd)
+	}
+	for _, c := range b.Traf {
+		l = append(l, c)
+	}
+	l = append(l, b.boxes...)
+	return l
+}
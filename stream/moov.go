@@ -1,39 +1,32 @@
 package stream
 
 import (
-	"bufio"
-	"encoding/binary"
 	"fmt"
 	"io"
 )
 
 // Movie Box (moov - mandatory)
 //
-// Status: partially decoded (anything other than mvhd, iods, trak or udta is ignored)
+// Status: partially decoded (anything other than mvhd, iods, trak, mvex or udta is ignored)
 //
 // Contains all meta-data. To be able to stream a file, the moov box should be placed before the mdat box.
 type MoovBox struct {
-	Mvhd   *MvhdBox
-	Trak   []*TrakBox
-	boxes  []Box
-	header [8]byte
+	Mvhd  *MvhdBox
+	Trak  []*TrakBox
+	Mvex  *MvexBox
+	boxes []Box
+	order []Box
 }
 
 func DecodeMoov(r io.Reader) (Box, error) {
-	l, err := DecodeContainer(bufio.NewReaderSize(r, 512*1024))
+	l, err := DecodeContainer(boxReader(r).buffered(512 * 1024))
 	if err != nil {
 		return nil, err
 	}
 	m := &MoovBox{}
-	for _, b := range l {
-		switch b.Type() {
-		case "mvhd":
-			m.Mvhd = b.(*MvhdBox)
-		case "trak":
-			m.Trak = append(m.Trak, b.(*TrakBox))
-		default:
-			m.boxes = append(m.boxes, b)
-		}
+	m.SetChildren(l)
+	if m.Mvhd == nil {
+		return nil, missingBox("mvhd")
 	}
 	return m, nil
 }
@@ -42,18 +35,8 @@ func (b *MoovBox) Type() string {
 	return "moov"
 }
 
-func (b *MoovBox) Size() (sz int) {
-	sz += b.Mvhd.Size()
-
-	for _, t := range b.Trak {
-		sz += t.Size()
-	}
-
-	for _, box := range b.boxes {
-		sz += box.Size()
-	}
-
-	return sz + BoxHeaderSize
+func (b *MoovBox) Size() int {
+	return boxSize(boxesSize(b.children()))
 }
 
 func (b *MoovBox) Dump() {
@@ -62,27 +45,60 @@ func (b *MoovBox) Dump() {
 		fmt.Println("Track", i)
 		t.Dump()
 	}
+	if b.Mvex != nil {
+		b.Mvex.Dump()
+	}
 }
 
-func (b *MoovBox) Encode(w io.Writer) (err error) {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err = w.Write(b.header[:])
-	if err != nil {
-		return
+func (b *MoovBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
 	}
 
-	for _, t := range b.Trak {
-		if err = t.Encode(w); err != nil {
-			return
-		}
-	}
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MoovBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
 
-	for _, b := range b.boxes {
-		if err = b.Encode(w); err != nil {
-			return
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MoovBox) SetChildren(l []Box) {
+	b.Mvhd, b.Trak, b.Mvex, b.boxes = nil, nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *MvhdBox:
+			if b.Mvhd == nil {
+				b.Mvhd = c
+				continue
+			}
+		case *TrakBox:
+			b.Trak = append(b.Trak, c)
+			continue
+		case *MvexBox:
+			if b.Mvex == nil {
+				b.Mvex = c
+				continue
+			}
 		}
+		b.boxes = append(b.boxes, c)
 	}
+	b.order = append([]Box{}, l...)
+}
 
-	return b.Mvhd.Encode(w)
+// children returns the children of the box, in the default order
+func (b *MoovBox) children() []Box {
+	var l []Box
+	if b.Mvhd != nil {
+		l = append(l, b.Mvhd)
+	}
+	for _, c := range b.Trak {
+		l = append(l, c)
+	}
+	if b.Mvex != nil {
+		l = append(l, b.Mvex)
+	}
+	l = append(l, b.boxes...)
+	return l
 }
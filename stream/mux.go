@@ -0,0 +1,506 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+var (
+	ErrNotSeekable       = errors.New("writer is not seekable")
+	ErrHeaderNotWritten  = errors.New("header not written")
+	ErrNoSampleEntry     = errors.New("track without sample entry")
+	ErrInvalidSampleTime = errors.New("sample decoding time goes backward")
+)
+
+// DefaultChunkDuration is the duration of the chunks written by a Muxer, by default
+const DefaultChunkDuration = time.Second
+
+// A Muxer writes a new media from samples: tracks are added, then WriteHeader, WriteSample and WriteTrailer
+// are called. W must be an io.WriteSeeker, unless with Faststart the media data goes to a temporary file.
+type Muxer struct {
+	W io.Writer
+
+	Faststart     bool
+	TempDir       string
+	ChunkDuration time.Duration
+	Timescale     uint32
+
+	Tracks    []*MuxTrack
+	TrackH264 *MuxTrack
+	TrackAAC  *MuxTrack
+
+	data    io.Writer
+	tmp     *os.File
+	ftyp    *FtypBox
+	start   int64
+	written int64
+	header  bool
+}
+
+// A track written by a Muxer
+type MuxTrack struct {
+	// Entry is the sample entry, built from the codec configuration for H.264 and AAC tracks
+	Entry Box
+
+	m         *Muxer
+	kind      TrackKind
+	timescale uint32
+	trackId   uint32
+	table     *SampleTableBuilder
+
+	width, height uint16
+	sps, pps      []byte
+	aacConfig     []byte
+
+	chunk        bytes.Buffer
+	chunkSamples uint32
+	chunkStart   int64
+
+	pending      bool
+	pendingPTS   int64
+	pendingDTS   int64
+	pendingSize  uint32
+	pendingSync  bool
+	lastDuration uint32
+}
+
+// AddTrack adds a track of the given kind, timescale (number of time units per second) and sample entry
+func (m *Muxer) AddTrack(kind TrackKind, timescale uint32, entry Box) *MuxTrack {
+	t := &MuxTrack{
+		Entry:     entry,
+		m:         m,
+		kind:      kind,
+		timescale: timescale,
+		trackId:   uint32(len(m.Tracks) + 1),
+		table:     NewSampleTableBuilder(),
+	}
+
+	if e, ok := entry.(*VisualSampleEntry); ok {
+		t.width, t.height = e.Width, e.Height
+	}
+
+	m.Tracks = append(m.Tracks, t)
+
+	return t
+}
+
+// AddH264Track adds a H.264 video track, with a timescale of 90000 units per second
+func (m *Muxer) AddH264Track() *MuxTrack {
+	t := m.AddTrack(TrackVideo, 90000, nil)
+	if m.TrackH264 == nil {
+		m.TrackH264 = t
+	}
+	return t
+}
+
+// AddAACTrack adds an AAC audio track, its timescale being the sample rate
+func (m *Muxer) AddAACTrack(sampleRate uint32) *MuxTrack {
+	t := m.AddTrack(TrackAudio, sampleRate, nil)
+	if m.TrackAAC == nil {
+		m.TrackAAC = t
+	}
+	return t
+}
+
+// SetTimeScale sets the number of time units per second of the track
+func (t *MuxTrack) SetTimeScale(timescale uint32) {
+	t.timescale = timescale
+}
+
+// TimeScale returns the number of time units per second of the track
+func (t *MuxTrack) TimeScale() uint32 {
+	return t.timescale
+}
+
+// SetResolution sets the width and height of a video track
+func (t *MuxTrack) SetResolution(width, height uint16) {
+	t.width, t.height = width, height
+}
+
+// SetH264SPS sets the sequence parameter set of a H.264 track
+func (t *MuxTrack) SetH264SPS(sps []byte) {
+	t.sps = sps
+}
+
+// SetH264PPS sets the picture parameter set of a H.264 track
+func (t *MuxTrack) SetH264PPS(pps []byte) {
+	t.pps = pps
+}
+
+// SetAACConfig sets the audio specific config of an AAC track
+func (t *MuxTrack) SetAACConfig(config []byte) {
+	t.aacConfig = config
+}
+
+// WriteHeader starts the media
+func (m *Muxer) WriteHeader() (err error) {
+	if m.ChunkDuration <= 0 {
+		m.ChunkDuration = DefaultChunkDuration
+	}
+
+	if m.Timescale == 0 {
+		m.Timescale = 1000
+	}
+
+	m.ftyp = NewFtyp(BrandIsom, 0x200, BrandIsom, BrandIso2, BrandMp41)
+	if m.TrackH264 != nil {
+		m.ftyp.AddBrands(BrandAvc1)
+	}
+
+	if m.Faststart {
+		if m.tmp, err = ioutil.TempFile(m.TempDir, "mp4mux"); err != nil {
+			return
+		}
+		m.data = m.tmp
+		m.header = true
+		return
+	}
+
+	s, seekable := m.W.(io.WriteSeeker)
+	if !seekable {
+		return ErrNotSeekable
+	}
+
+	if m.start, err = s.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+
+	if err = m.ftyp.Encode(m.W); err != nil {
+		return
+	}
+
+	// A free box is written before the mdat header, to switch to a 64 bits header if needed
+	if err = encodeHeader(m.W, "free", BoxHeaderSize, false); err != nil {
+		return
+	}
+
+	if err = encodeHeader(m.W, "mdat", BoxHeaderSize, false); err != nil {
+		return
+	}
+
+	m.data = m.W
+	m.header = true
+
+	return
+}
+
+// WriteSample writes a sample of the track. Times are in the track timescale.
+func (t *MuxTrack) WriteSample(pts, dts int64, isKeyFrame bool, data []byte) (err error) {
+	if !t.m.header {
+		return ErrHeaderNotWritten
+	}
+
+	if t.pending {
+		if dts < t.pendingDTS {
+			return ErrInvalidSampleTime
+		}
+		t.addPending(uint32(dts - t.pendingDTS))
+	}
+
+	if t.chunkSamples > 0 && dts-t.chunkStart >= int64(DurationToUnits(t.m.ChunkDuration, t.timescale)) {
+		if err = t.flushChunk(); err != nil {
+			return
+		}
+	}
+
+	if t.chunkSamples == 0 {
+		t.chunkStart = dts
+	}
+
+	t.chunk.Write(data)
+	t.chunkSamples++
+
+	t.pending = true
+	t.pendingPTS = pts
+	t.pendingDTS = dts
+	t.pendingSize = uint32(len(data))
+	t.pendingSync = isKeyFrame
+
+	return
+}
+
+// addPending adds the last written sample to the sample table, once its duration is known
+func (t *MuxTrack) addPending(duration uint32) {
+	t.table.AddSample(duration, int32(t.pendingPTS-t.pendingDTS), t.pendingSize, t.pendingSync)
+	t.lastDuration = duration
+	t.pending = false
+}
+
+// flushChunk writes the current chunk in the mdat box
+func (t *MuxTrack) flushChunk() error {
+	if t.chunkSamples == 0 {
+		return nil
+	}
+
+	t.table.AddChunk(uint64(t.m.written), t.chunkSamples, 1)
+
+	n, err := t.m.data.Write(t.chunk.Bytes())
+	t.m.written += int64(n)
+
+	t.chunk.Reset()
+	t.chunkSamples = 0
+
+	return err
+}
+
+// WriteTrailer writes the remaining chunks and the moov box
+func (m *Muxer) WriteTrailer() (err error) {
+	if !m.header {
+		return ErrHeaderNotWritten
+	}
+
+	if m.tmp != nil {
+		defer func() {
+			m.tmp.Close()
+			os.Remove(m.tmp.Name())
+		}()
+	}
+
+	for _, t := range m.Tracks {
+		if t.pending {
+			t.addPending(t.lastDuration)
+		}
+		if err = t.flushChunk(); err != nil {
+			return
+		}
+	}
+
+	moov, err := m.buildMoov()
+	if err != nil {
+		return
+	}
+
+	if m.Faststart {
+		return m.writeFaststart(moov)
+	}
+
+	s := m.W.(io.WriteSeeker)
+
+	// The chunks follow the free box and the mdat header
+	RelocateChunks(moov, func(int) uint64 {
+		return uint64(m.start) + uint64(m.ftyp.Size()) + LargeBoxHeaderSize
+	})
+
+	if _, err = s.Seek(m.start+int64(m.ftyp.Size()), io.SeekStart); err != nil {
+		return
+	}
+
+	if uint64(m.written)+BoxHeaderSize > math.MaxUint32 {
+		// The 64 bits mdat header replaces the free box
+		err = encodeHeader(m.W, "mdat", LargeBoxHeaderSize+int(m.written), true)
+	} else if err = encodeHeader(m.W, "free", BoxHeaderSize, false); err == nil {
+		err = encodeHeader(m.W, "mdat", BoxHeaderSize+int(m.written), false)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if _, err = s.Seek(0, io.SeekEnd); err != nil {
+		return
+	}
+
+	return moov.Encode(m.W)
+}
+
+// writeFaststart writes the whole media, the moov box first
+func (m *Muxer) writeFaststart(moov *MoovBox) (err error) {
+	mdat := &MdatBox{
+		ContentSize: uint64(m.written),
+		r:           m.tmp,
+		seekable:    true,
+	}
+
+	RelocateChunks(moov, func(moovSize int) uint64 {
+		return uint64(m.ftyp.Size() + moovSize + mdat.HeaderSize())
+	})
+
+	if err = m.ftyp.Encode(m.W); err != nil {
+		return
+	}
+
+	if err = moov.Encode(m.W); err != nil {
+		return
+	}
+
+	return mdat.Encode(m.W)
+}
+
+// buildMoov returns the moov box describing the tracks
+func (m *Muxer) buildMoov() (*MoovBox, error) {
+	moov := &MoovBox{
+		Mvhd: NewMvhdBox(m.Timescale),
+	}
+
+	for _, t := range m.Tracks {
+		trak, err := t.buildTrak(m.Timescale)
+		if err != nil {
+			return nil, err
+		}
+
+		if trak.Tkhd.Duration > moov.Mvhd.Duration {
+			moov.Mvhd.Duration = trak.Tkhd.Duration
+		}
+
+		moov.Trak = append(moov.Trak, trak)
+	}
+
+	moov.Mvhd.NextTrackId = uint32(len(m.Tracks) + 1)
+
+	return moov, nil
+}
+
+// buildTrak returns the trak box of the track
+func (t *MuxTrack) buildTrak(movieTimescale uint32) (*TrakBox, error) {
+	entry, err := t.sampleEntry()
+	if err != nil {
+		return nil, err
+	}
+
+	duration := t.table.Duration()
+
+	trak := &TrakBox{
+		Tkhd: NewTkhdBox(t.trackId),
+		Mdia: &MdiaBox{
+			Mdhd: &MdhdBox{
+				Timescale: t.timescale,
+				Duration:  duration,
+				Language:  0x55c4, // und
+			},
+			Minf: &MinfBox{
+				Stbl: t.table.Build(&StsdBox{Entries: []Box{entry}}),
+			},
+		},
+	}
+
+	trak.Tkhd.Duration = RescaleUnits(duration, t.timescale, movieTimescale)
+
+	// Media header
+	var mhd Box
+
+	switch t.kind {
+	case TrackVideo:
+		trak.Mdia.Hdlr = NewHdlrBox("vide", "VideoHandler")
+		trak.Tkhd.Width, trak.Tkhd.Height = Fixed32(t.width)<<16, Fixed32(t.height)<<16
+		mhd = NewUniBox("vmhd", []byte{0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0})
+	case TrackAudio:
+		trak.Mdia.Hdlr = NewHdlrBox("soun", "SoundHandler")
+		trak.Tkhd.Volume = 0x100
+		trak.Tkhd.AlternateGroup = 1
+		mhd = NewUniBox("smhd", make([]byte, 8))
+	case TrackSubtitle:
+		trak.Mdia.Hdlr = NewHdlrBox("subt", "SubtitleHandler")
+		mhd = NewUniBox("sthd", make([]byte, 4))
+	default:
+		trak.Mdia.Hdlr = NewHdlrBox(t.kind.handler(), "")
+		mhd = NewUniBox("nmhd", make([]byte, 4))
+	}
+
+	dref := NewUniBox("dref", append([]byte{0, 0, 0, 0, 0, 0, 0, 1}, 0, 0, 0, 12, 'u', 'r', 'l', ' ', 0, 0, 0, 1))
+	dinf := NewUniBox("dinf", encodeBoxes(dref))
+
+	trak.Mdia.Minf.boxes = []Box{mhd, dinf}
+
+	return trak, nil
+}
+
+// sampleEntry returns the sample entry of the track, built from the codec configuration if needed
+func (t *MuxTrack) sampleEntry() (Box, error) {
+	switch {
+	case t.Entry != nil:
+		return t.Entry, nil
+	case t.sps != nil && t.pps != nil:
+		e := NewVisualSampleEntry("avc1", t.width, t.height)
+		e.Boxes = []Box{NewUniBox("avcC", avcConfig(t.sps, t.pps))}
+		return e, nil
+	case t.aacConfig != nil:
+		channels, rate := aacParameters(t.aacConfig)
+		if rate == 0 {
+			rate = t.timescale
+		}
+		// A rate above 65535 doesn't fit in 16.16: an integer division of it is written (ISO/IEC 14496-12
+		// allows it), the decoder configuration giving the rate
+		for rate > math.MaxUint16 {
+			rate /= 2
+		}
+		e := NewAudioSampleEntry("mp4a", channels, uint16(rate))
+		e.Boxes = []Box{NewUniBox("esds", esdsConfig(t.trackId, t.aacConfig))}
+		return e, nil
+	}
+
+	return nil, ErrNoSampleEntry
+}
+
+// avcConfig returns the content of an avcC box (AVCDecoderConfigurationRecord) holding one SPS and one PPS
+func avcConfig(sps, pps []byte) []byte {
+	b := []byte{1, 0, 0, 0, 0xff, 0xe1}
+	if len(sps) >= 4 {
+		copy(b[1:4], sps[1:4])
+	}
+	b = append(b, byte(len(sps)>>8), byte(len(sps)))
+	b = append(b, sps...)
+	b = append(b, 1, byte(len(pps)>>8), byte(len(pps)))
+	return append(b, pps...)
+}
+
+// aacSampleRates are the sample rates of the AAC sampling frequency indexes
+var aacSampleRates = []uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// aacParameters returns the channel count and sample rate (or 0) of an AAC audio specific config
+func aacParameters(config []byte) (channels uint16, rate uint32) {
+	if len(config) < 2 {
+		return 2, 0
+	}
+	if i := (config[0]&7)<<1 | config[1]>>7; int(i) < len(aacSampleRates) {
+		rate = aacSampleRates[i]
+	}
+	return uint16(config[1]>>3) & 0xf, rate
+}
+
+// esdsConfig returns the content of an esds box holding an AAC audio specific config
+func esdsConfig(trackId uint32, config []byte) []byte {
+	dsi := descriptor(5, config)
+	dcd := descriptor(4, append([]byte{0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, dsi...))
+	sl := descriptor(6, []byte{2})
+	es := descriptor(3, append(append([]byte{byte(trackId >> 8), byte(trackId), 0}, dcd...), sl...))
+	return append([]byte{0, 0, 0, 0}, es...)
+}
+
+// descriptor returns a MPEG-4 descriptor (tag, variable length size, body)
+func descriptor(tag byte, body []byte) []byte {
+	n := len(body)
+	return append([]byte{tag, byte(n>>21) | 0x80, byte(n>>14) | 0x80, byte(n>>7) | 0x80, byte(n) & 0x7f}, body...)
+}
+
+// encodeBoxes returns the encoded boxes
+func encodeBoxes(l ...Box) []byte {
+	var b bytes.Buffer
+	for _, box := range l {
+		box.Encode(&b)
+	}
+	return b.Bytes()
+}
+
+// handler returns the handler type of a track kind
+func (k TrackKind) handler() string {
+	switch k {
+	case TrackVideo:
+		return "vide"
+	case TrackAudio:
+		return "soun"
+	case TrackSubtitle:
+		return "subt"
+	case TrackHint:
+		return "hint"
+	case TrackMetadata:
+		return "meta"
+	case TrackTimecode:
+		return "tmcd"
+	}
+	return "null"
+}
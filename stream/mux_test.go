@@ -0,0 +1,179 @@
+package stream
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// A file in memory, its content beginning at base
+type memFile struct {
+	base int64
+	pos  int64
+	data []byte
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos - f.base + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[f.pos-f.base:], p)
+	f.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.base + int64(len(f.data))
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+// A sample written by a muxer
+type muxSample struct {
+	pts, dts int64
+	sync     bool
+	data     []byte
+}
+
+// muxTestSamples returns the samples of a H.264 track (25 frames per second, with B-frames) and of an AAC
+// track (1024 audio samples per frame at the given rate), for 3 seconds
+func muxTestSamples(rate int64) [2][]muxSample {
+	var tracks [2][]muxSample
+
+	for i := int64(0); i < 75; i++ {
+		pts := i * 3600
+		if i%3 > 0 {
+			// The B-frames are presented before the following P-frame
+			pts = (i + 1 - 2*(i%3-1)) * 3600
+		}
+		tracks[0] = append(tracks[0], muxSample{pts, i * 3600, i%25 == 0, []byte(fmt.Sprintf("video %d", i))})
+	}
+
+	for i := int64(0); i*1024 < 3*rate; i++ {
+		tracks[1] = append(tracks[1], muxSample{i * 1024, i * 1024, true, []byte(fmt.Sprintf("audio %d", i))})
+	}
+
+	return tracks
+}
+
+// TestMuxer writes medias with a muxer, and checks their samples once decoded
+func TestMuxer(t *testing.T) {
+	tests := []struct {
+		name      string
+		faststart bool
+		base      int64 // the position of the media in the file
+		rate      uint32
+		entryRate uint32 // the sample rate of the audio sample entry
+	}{
+		{name: "moov last", rate: 44100, entryRate: 44100},
+		{name: "faststart", faststart: true, rate: 48000, entryRate: 48000},
+		{name: "co64", base: 5 << 30, rate: 44100, entryRate: 44100},
+		{name: "high sample rate", faststart: true, rate: 96000, entryRate: 48000},
+	}
+
+	config := map[uint32][]byte{44100: {0x12, 0x10}, 48000: {0x11, 0x90}, 96000: {0x10, 0x10}}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		f := &memFile{base: tt.base, pos: tt.base}
+		m := &Muxer{W: f, Faststart: tt.faststart, TempDir: dir}
+
+		video := m.AddH264Track()
+		video.SetH264SPS([]byte{0x67, 0x64, 0, 0x1f})
+		video.SetH264PPS([]byte{0x68, 0xee})
+		video.SetResolution(640, 480)
+
+		audio := m.AddAACTrack(tt.rate)
+		audio.SetAACConfig(config[tt.rate])
+
+		if err := m.WriteHeader(); err != nil {
+			t.Fatal(tt.name, err)
+		}
+
+		samples := muxTestSamples(int64(tt.rate))
+
+		for i, track := range []*MuxTrack{video, audio} {
+			for _, s := range samples[i] {
+				if err := track.WriteSample(s.pts, s.dts, s.sync, s.data); err != nil {
+					t.Fatal(tt.name, err)
+				}
+			}
+		}
+
+		if err := m.WriteTrailer(); err != nil {
+			t.Fatal(tt.name, err)
+		}
+
+		if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+			t.Errorf("%s: the temporary file isn't removed", tt.name)
+		}
+
+		d, err := DecodeSeeker(bytes.NewReader(f.data))
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+
+		if len(d.Moov.Trak) != 2 {
+			t.Fatalf("%s: got %d tracks, want 2", tt.name, len(d.Moov.Trak))
+		}
+
+		for i, trak := range d.Moov.Trak {
+			if stbl := trak.Mdia.Minf.Stbl; (stbl.Co64 != nil) != (tt.base > 0) {
+				t.Errorf("%s: track %d: co64 box %v, want %v", tt.name, i, stbl.Co64 != nil, tt.base > 0)
+			}
+
+			n := 0
+
+			it := d.Samples(trak)
+			for ; it.Next(); n++ {
+				s, want := it.Sample(), samples[i][n]
+				data := f.data[s.Offset-tt.base : s.Offset-tt.base+int64(s.Size)]
+
+				if s.PTS != want.pts || int64(s.DTS) != want.dts || s.IsSync != want.sync || !bytes.Equal(data, want.data) {
+					t.Fatalf("%s: track %d: sample %d differs from the written sample", tt.name, i, n)
+				}
+			}
+
+			if it.Err() != nil || n != len(samples[i]) {
+				t.Fatalf("%s: track %d: got %d samples, want %d (%v)", tt.name, i, n, len(samples[i]), it.Err())
+			}
+		}
+
+		e, ok := d.Moov.Trak[1].Mdia.Minf.Stbl.Stsd.Entries[0].(*AudioSampleEntry)
+		if !ok || e.SampleRate != Fixed32(tt.entryRate)<<16 || d.Moov.Trak[1].Mdia.Mdhd.Timescale != tt.rate {
+			t.Errorf("%s: invalid audio sample rate", tt.name)
+		}
+	}
+}
+
+// TestMuxerTempFile checks that the temporary file of a faststart muxer is removed when the media can't
+// be written
+func TestMuxerTempFile(t *testing.T) {
+	dir := t.TempDir()
+	m := &Muxer{W: ioutil.Discard, Faststart: true, TempDir: dir}
+
+	track := m.AddTrack(TrackVideo, 90000, nil)
+
+	if err := m.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := track.WriteSample(0, 0, true, []byte("sample")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.WriteTrailer(); err != ErrNoSampleEntry {
+		t.Fatalf("got %v, want %v", err, ErrNoSampleEntry)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) > 0 {
+		t.Error("the temporary file isn't removed")
+	}
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+)
+
+// Movie Extends Box (mvex - optional)
+//
+// Contained in : Movie Box (moov)
+//
+// Status: decoded
+//
+// Its presence warns that the media is fragmented: the samples of the tracks may be described in movie
+// fragments (moof) following the moov box. It contains the default values (trex) used by the fragments
+// of each track, and optionally the overall duration of the fragmented movie (mehd).
+type MvexBox struct {
+	Mehd  *MehdBox
+	Trex  []*TrexBox
+	boxes []Box
+	order []Box
+}
+
+func DecodeMvex(r io.Reader) (Box, error) {
+	l, err := DecodeContainer(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &MvexBox{}
+	m.SetChildren(l)
+	return m, nil
+}
+
+func (b *MvexBox) Type() string {
+	return "mvex"
+}
+
+func (b *MvexBox) Size() int {
+	return boxSize(boxesSize(b.children()))
+}
+
+// TrackExtends returns the default values used by the fragments of a track, or nil
+func (b *MvexBox) TrackExtends(trackId uint32) *TrexBox {
+	for _, t := range b.Trex {
+		if t.TrackId == trackId {
+			return t
+		}
+	}
+	return nil
+}
+
+func (b *MvexBox) Dump() {
+	fmt.Println("Movie Extends:")
+	if b.Mehd != nil {
+		fmt.Printf(" Fragment duration: %d units\n", b.Mehd.FragmentDuration)
+	}
+	for _, t := range b.Trex {
+		fmt.Printf(" Track %d : description #%d, duration %d, size %d, flags %#x\n", t.TrackId, t.DefaultSampleDescriptionIndex,
+			t.DefaultSampleDuration, t.DefaultSampleSize, t.DefaultSampleFlags)
+	}
+}
+
+func (b *MvexBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *MvexBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *MvexBox) SetChildren(l []Box) {
+	b.Mehd, b.Trex, b.boxes = nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *MehdBox:
+			if b.Mehd == nil {
+				b.Mehd = c
+				continue
+			}
+		case *TrexBox:
+			b.Trex = append(b.Trex, c)
+			continue
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *MvexBox) children() []Box {
+	var l []Box
+	if b.Mehd != nil {
+		l = append(l, b.Mehd)
+	}
+	for _, c := range b.Trex {
+		l = append(l, c)
+	}
+	l = append(l, b.boxes...)
+	return l
+}
@@ -4,28 +4,29 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
-	"time"
+	"math"
 )
 
 // Movie Header Box (mvhd - mandatory)
 //
 // Contained in : Movie Box (‘moov’)
 //
-// Status: version 0 is partially decoded. version 1 is not supported
+// Status: partially decoded
 //
 // Contains all media information (duration, ...).
 //
 // Duration is measured in "time units", and timescale defines the number of time units per second.
 //
-// Only version 0 is decoded.
+// Version 0 stores times and duration on 32 bits, version 1 on 64 bits. Version 1 is encoded when
+// Version is 1 or when a value doesn't fit in 32 bits.
 type MvhdBox struct {
 	Version          byte
 	Flags            [3]byte
 	header           [8]byte
-	CreationTime     uint32
-	ModificationTime uint32
+	CreationTime     uint64
+	ModificationTime uint64
 	Timescale        uint32
-	Duration         uint32
+	Duration         uint64
 	NextTrackId      uint32
 	Rate             Fixed32
 	Volume           Fixed16
@@ -37,29 +38,68 @@ func DecodeMvhd(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &MvhdBox{
-		Version:          data[0],
-		Flags:            [3]byte{data[1], data[2], data[3]},
-		CreationTime:     binary.BigEndian.Uint32(data[4:8]),
-		ModificationTime: binary.BigEndian.Uint32(data[8:12]),
-		Timescale:        binary.BigEndian.Uint32(data[12:16]),
-		Duration:         binary.BigEndian.Uint32(data[16:20]),
-		Rate:             fixed32(data[20:24]),
-		Volume:           fixed16(data[24:26]),
-		notDecoded:       data[26:],
-	}, nil
+	if len(data) < 26 || data[0] == 1 && len(data) < 38 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &MvhdBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+	}
+	if b.Version == 1 {
+		b.CreationTime = binary.BigEndian.Uint64(data[4:12])
+		b.ModificationTime = binary.BigEndian.Uint64(data[12:20])
+		b.Timescale = binary.BigEndian.Uint32(data[20:24])
+		b.Duration = binary.BigEndian.Uint64(data[24:32])
+		data = data[32:]
+	} else {
+		b.CreationTime = uint64(binary.BigEndian.Uint32(data[4:8]))
+		b.ModificationTime = uint64(binary.BigEndian.Uint32(data[8:12]))
+		b.Timescale = binary.BigEndian.Uint32(data[12:16])
+		b.Duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+		data = data[20:]
+	}
+	b.Rate = fixed32(data[0:4])
+	b.Volume = fixed16(data[4:6])
+	b.notDecoded = data[6:]
+	if len(b.notDecoded) >= 74 {
+		b.NextTrackId = binary.BigEndian.Uint32(b.notDecoded[70:74])
+	}
+	return b, nil
+}
+
+// NewMvhdBox returns a movie header with the default values (rate, volume, matrix)
+func NewMvhdBox(timescale uint32) *MvhdBox {
+	b := &MvhdBox{
+		Timescale:   timescale,
+		NextTrackId: 1,
+		Rate:        0x10000,
+		Volume:      0x100,
+		notDecoded:  make([]byte, 74),
+	}
+	copy(b.notDecoded[10:46], unityMatrix())
+	return b
 }
 
 func (b *MvhdBox) Type() string {
 	return "mvhd"
 }
 
+func (b *MvhdBox) version() byte {
+	if b.Version == 1 || b.CreationTime > math.MaxUint32 || b.ModificationTime > math.MaxUint32 || b.Duration > math.MaxUint32 {
+		return 1
+	}
+	return 0
+}
+
 func (b *MvhdBox) Size() int {
+	if b.version() == 1 {
+		return BoxHeaderSize + 38 + len(b.notDecoded)
+	}
 	return BoxHeaderSize + 26 + len(b.notDecoded)
 }
 
 func (b *MvhdBox) Dump() {
-	fmt.Printf("Movie Header:\n Timescale: %d units/sec\n Duration: %d units (%s)\n Rate: %s\n Volume: %s\n", b.Timescale, b.Duration, time.Duration(b.Duration/b.Timescale)*time.Second, b.Rate, b.Volume)
+	fmt.Printf("Movie Header:\n Timescale: %d units/sec\n Duration: %d units (%s)\n Rate: %s\n Volume: %s\n", b.Timescale, b.Duration, UnitsToDuration(b.Duration, b.Timescale), b.Rate, b.Volume)
 }
 
 func (b *MvhdBox) Encode(w io.Writer) error {
@@ -70,15 +110,27 @@ func (b *MvhdBox) Encode(w io.Writer) error {
 		return err
 	}
 	buf := makebuf(b)
-	buf[0] = b.Version
+	buf[0] = b.version()
 	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
-	binary.BigEndian.PutUint32(buf[4:], b.CreationTime)
-	binary.BigEndian.PutUint32(buf[8:], b.ModificationTime)
-	binary.BigEndian.PutUint32(buf[12:], b.Timescale)
-	binary.BigEndian.PutUint32(buf[16:], b.Duration)
-	binary.BigEndian.PutUint32(buf[20:], uint32(b.Rate))
-	binary.BigEndian.PutUint16(buf[24:], uint16(b.Volume))
-	copy(buf[26:], b.notDecoded)
+	n := 20
+	if buf[0] == 1 {
+		binary.BigEndian.PutUint64(buf[4:], b.CreationTime)
+		binary.BigEndian.PutUint64(buf[12:], b.ModificationTime)
+		binary.BigEndian.PutUint32(buf[20:], b.Timescale)
+		binary.BigEndian.PutUint64(buf[24:], b.Duration)
+		n = 32
+	} else {
+		binary.BigEndian.PutUint32(buf[4:], uint32(b.CreationTime))
+		binary.BigEndian.PutUint32(buf[8:], uint32(b.ModificationTime))
+		binary.BigEndian.PutUint32(buf[12:], b.Timescale)
+		binary.BigEndian.PutUint32(buf[16:], uint32(b.Duration))
+	}
+	binary.BigEndian.PutUint32(buf[n:], uint32(b.Rate))
+	binary.BigEndian.PutUint16(buf[n+4:], uint16(b.Volume))
+	copy(buf[n+6:], b.notDecoded)
+	if len(b.notDecoded) >= 74 {
+		binary.BigEndian.PutUint32(buf[n+6+70:], b.NextTrackId)
+	}
 	_, err = w.Write(buf)
 	return err
 }
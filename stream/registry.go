@@ -0,0 +1,196 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+var (
+	pathDecoders = map[string]BoxDecoder{}
+	uuidDecoders = map[[16]byte]BoxDecoder{}
+)
+
+// A BoxReader reads the content of a box being decoded (header excluded)
+//
+// The decoders receive a *BoxReader, which tells where the box is: Path lists the types of its parents and
+// its own type (for example moov, udta, meta), Offset is the position of the box in the file and
+// HeaderSize the size of its header. Offset is relative to the beginning of the decoded data when the
+// position in the file isn't known.
+//
+// For a uuid box, ExtendedType is its user type. When the box is decoded by a decoder registered with
+// RegisterUUIDDecoder, the user type has already been read: the content begins after it.
+type BoxReader struct {
+	io.Reader
+
+	Path         []string
+	Offset       int64
+	HeaderSize   int
+	ExtendedType []byte
+}
+
+// RegisterDecoder registers the decoder of a box type, wherever the box is. It replaces the built-in
+// decoder of the type, if any, and a nil decoder removes it.
+//
+// The decoded boxes are kept in their containers (in Boxes or in the other boxes of a typed container),
+// and are encoded by their own Size and Encode methods. Decoders must be registered before decoding, from
+// an init function for example: registering isn't safe while medias are decoded.
+func RegisterDecoder(ht string, d BoxDecoder) {
+	if d == nil {
+		delete(decoders, ht)
+		return
+	}
+	decoders[ht] = d
+}
+
+// RegisterPathDecoder registers the decoder of a box at a given path: the types of its parents and its
+// own type, separated by slashes (for example "moov/udta/meta"). It takes precedence over the decoders of
+// box types. A nil decoder removes it.
+func RegisterPathDecoder(path string, d BoxDecoder) {
+	path = strings.Trim(path, "/")
+	if d == nil {
+		delete(pathDecoders, path)
+		return
+	}
+	pathDecoders[path] = d
+}
+
+// RegisterUUIDDecoder registers the decoder of uuid boxes having a given user type (extended type). The
+// decoder reads the content following the user type, the user type being given by
+// BoxReader.ExtendedType: the box encodes it back. A nil decoder removes it.
+//
+// Path decoders take precedence over it, uuid boxes without a registered decoder are kept as *UniBox.
+func RegisterUUIDDecoder(uuid [16]byte, d BoxDecoder) {
+	if d == nil {
+		delete(uuidDecoders, uuid)
+		return
+	}
+	uuidDecoders[uuid] = d
+}
+
+// EncodeHeader writes the header of a box of the given type and size (header included), for boxes
+// implemented outside of this package. The 64 bits header is used when the size doesn't fit in 32 bits.
+func EncodeHeader(w io.Writer, ht string, size int) error {
+	return encodeHeader(w, ht, size, false)
+}
+
+// UUIDString formats a uuid box user type (8-4-4-4-12 hexadecimal digits)
+func UUIDString(uuid []byte) string {
+	s := hex.EncodeToString(uuid)
+	if len(s) != 32 {
+		return s
+	}
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// boxReader returns r as a *BoxReader. Another reader holds top-level boxes: the path is empty, and the
+// offsets are relative to its beginning.
+func boxReader(r io.Reader) *BoxReader {
+	if br, ok := r.(*BoxReader); ok {
+		return br
+	}
+	return &BoxReader{Reader: r}
+}
+
+// child returns the reader of a child box of type ht, starting at offset in the content of the box
+func (r *BoxReader) child(cr io.Reader, ht string, offset int64, hs int) *BoxReader {
+	path := make([]string, len(r.Path), len(r.Path)+1)
+	copy(path, r.Path)
+
+	return &BoxReader{
+		Reader:     cr,
+		Path:       append(path, ht),
+		Offset:     r.Offset + int64(r.HeaderSize) + offset,
+		HeaderSize: hs,
+	}
+}
+
+// buffered returns the reader of the box, buffered. The size of the content is kept, for the children to be
+// checked against it.
+func (r *BoxReader) buffered(size int) *BoxReader {
+	var br io.Reader = bufio.NewReaderSize(r.Reader, size)
+	if lr, ok := r.Reader.(*io.LimitedReader); ok {
+		br = io.LimitReader(br, lr.N)
+	}
+
+	return &BoxReader{
+		Reader:       br,
+		Path:         r.Path,
+		Offset:       r.Offset,
+		HeaderSize:   r.HeaderSize,
+		ExtendedType: r.ExtendedType,
+	}
+}
+
+// content returns a reader of data, the part of the content of the box starting at offset, for boxes whose
+// children follow some fields (sample entries for example)
+func (r *BoxReader) content(data []byte, offset int64) *BoxReader {
+	return &BoxReader{
+		Reader:     bytes.NewReader(data),
+		Path:       r.Path,
+		Offset:     r.Offset + offset,
+		HeaderSize: r.HeaderSize,
+	}
+}
+
+// decodeError returns err as a *DecodeError locating the box, unless err already locates one of its
+// children
+func (r *BoxReader) decodeError(err error) error {
+	if _, ok := err.(*DecodeError); ok || err == nil {
+		return err
+	}
+	return &DecodeError{Path: r.Path, Offset: r.Offset, Err: err}
+}
+
+// headerError returns err, the error reading the header of a child box at offset in the content of the
+// box, as a *DecodeError
+func (r *BoxReader) headerError(offset int64, err error) error {
+	return &DecodeError{Path: r.Path, Offset: r.Offset + int64(r.HeaderSize) + offset, Err: err}
+}
+
+// decodeBox decodes the content of a box with the decoder registered for its path, its user type (uuid
+// boxes) or its type, a box without decoder being kept as *UniBox
+func decodeBox(ht string, r io.Reader) (Box, error) {
+	return decodeBoxOr(ht, r, DecodeUni)
+}
+
+// decodeBoxOr decodes the content of a box as decodeBox, a box without decoder being decoded by unknown
+//
+// The errors are returned as *DecodeError.
+func decodeBoxOr(ht string, r io.Reader, unknown func(io.Reader, string) (Box, error)) (b Box, err error) {
+	br := boxReader(r)
+
+	defer func() {
+		err = br.decodeError(err)
+	}()
+
+	if d := pathDecoders[strings.Join(br.Path, "/")]; d != nil && len(br.Path) > 0 {
+		return d(br)
+	}
+
+	if ht == "uuid" && len(uuidDecoders) > 0 {
+		var uuid [16]byte
+
+		var n int
+		n, err = io.ReadFull(br.Reader, uuid[:])
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+
+		if d := uuidDecoders[uuid]; d != nil && n == len(uuid) {
+			br.ExtendedType = uuid[:]
+			return d(br)
+		}
+
+		// The user type is kept in the content
+		br.Reader = io.MultiReader(bytes.NewReader(uuid[:n]), br.Reader)
+	}
+
+	if d := decoders[ht]; d != nil {
+		return d(br)
+	}
+
+	return unknown(br, ht)
+}
@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// TestRegisterCoreDecoders replaces the decoders of mdat and moov boxes, the media being decoded without
+// the typed boxes
+func TestRegisterCoreDecoders(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+	if src == nil {
+		t.Fatal("no test media")
+	}
+
+	defer RegisterDecoder("mdat", DecodeMdat)
+	defer RegisterDecoder("moov", DecodeMoov)
+
+	// The media data is read, so that the moov box following it is decoded
+	RegisterDecoder("mdat", func(r io.Reader) (Box, error) {
+		return DecodeUni(r, "mdat")
+	})
+
+	m, err := Decode(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Mdat != nil || len(m.Boxes()) != 1 || m.Boxes()[0].Type() != "mdat" {
+		t.Fatal("the mdat box isn't kept as an other box")
+	}
+
+	var b bytes.Buffer
+
+	if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), src) {
+		t.Fatal("the encoded media differs from the decoded one", err)
+	}
+
+	RegisterDecoder("moov", func(r io.Reader) (Box, error) {
+		return DecodeUni(r, "moov")
+	})
+
+	if _, err = Decode(bytes.NewReader(src)); err != ErrNoMoov {
+		t.Fatalf("got %v, want %v", err, ErrNoMoov)
+	}
+}
+
+// TestRegisterSampleEntryDecoders replaces the decoders of sample entries, by type and by path
+func TestRegisterSampleEntryDecoders(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+	if src == nil {
+		t.Fatal("no test media")
+	}
+
+	defer RegisterDecoder("avc1", nil)
+	defer RegisterPathDecoder("moov/trak/mdia/minf/stbl/stsd/mp4a", nil)
+
+	RegisterDecoder("avc1", func(r io.Reader) (Box, error) {
+		return DecodeUni(r, "avc1")
+	})
+	RegisterPathDecoder("moov/trak/mdia/minf/stbl/stsd/mp4a", func(r io.Reader) (Box, error) {
+		return DecodeUni(r, "mp4a")
+	})
+
+	m, err := DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := 0
+
+	for _, trak := range m.Moov.Trak {
+		for _, e := range trak.Mdia.Minf.Stbl.Stsd.Entries {
+			if _, ok := e.(*UniBox); !ok {
+				t.Fatalf("the %s sample entry isn't decoded by the registered decoder", e.Type())
+			}
+			entries++
+		}
+	}
+
+	if entries != 2 {
+		t.Fatalf("got %d sample entries, want 2", entries)
+	}
+
+	var b bytes.Buffer
+
+	if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), src) {
+		t.Fatal("the encoded media differs from the decoded one", err)
+	}
+}
@@ -0,0 +1,571 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+)
+
+var (
+	ErrInvalidSampleTable = errors.New("invalid sample table")
+)
+
+// A sample of a track: its position in the file, and its times in the media timescale (edit list not applied)
+type Sample struct {
+	Index            uint32
+	Offset           int64
+	Size             uint32
+	DTS              uint64
+	PTS              int64
+	Duration         uint32
+	IsSync           bool
+	DescriptionIndex uint32
+}
+
+// SampleIterator lists the samples of a track, from the sample table (stbl) then from the movie fragments
+type SampleIterator struct {
+	m   *MP4
+	t   *TrakBox
+	s   Sample
+	err error
+
+	next uint32
+	dts  uint64
+
+	// sample table
+	count       uint32
+	chunk       int
+	sci         int
+	chunkLeft   uint32
+	offset      int64
+	description uint32
+	stts        runCursor
+	ctts        runCursor
+	stss        int
+
+	// fragments
+	frag     int
+	traf     int
+	trun     int
+	sample   int
+	base     int64
+	defaults trafDefaults
+}
+
+// A position in a run-length table (stts, ctts)
+type runCursor struct {
+	i int
+	n uint32
+}
+
+// next returns the run of the next sample, or -1 after the end of the table
+func (c *runCursor) next(counts []uint32) int {
+	for c.i < len(counts) && c.n >= counts[c.i] {
+		c.i++
+		c.n = 0
+	}
+	if c.i >= len(counts) {
+		return -1
+	}
+	c.n++
+	return c.i
+}
+
+// The default values of the samples of a track fragment
+type trafDefaults struct {
+	description, duration, size, flags uint32
+}
+
+// Samples returns an iterator over the samples of a track
+func (m *MP4) Samples(t *TrakBox) *SampleIterator {
+	it := &SampleIterator{
+		m: m,
+		t: t,
+	}
+
+	if t.Mdia == nil || t.Mdia.Minf == nil {
+		return it
+	}
+
+	if stbl := t.Mdia.Minf.Stbl; stbl != nil && stbl.Stsz != nil {
+		it.count = stbl.Stsz.SampleNumber
+	}
+
+	return it
+}
+
+// Next advances to the next sample. It returns false at the end of the track, or on error.
+func (it *SampleIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.next < it.count {
+		it.err = it.tableSample()
+	} else if !it.fragmentSample() {
+		return false
+	}
+
+	if it.err != nil {
+		return false
+	}
+
+	it.next++
+
+	return true
+}
+
+// Sample returns the current sample
+func (it *SampleIterator) Sample() Sample {
+	return it.s
+}
+
+// Err returns the error met while iterating, if any
+func (it *SampleIterator) Err() error {
+	return it.err
+}
+
+// tableSample reads the next sample from the sample table
+func (it *SampleIterator) tableSample() error {
+	stbl := it.t.Mdia.Minf.Stbl
+	stsc := stbl.Stsc
+
+	for it.chunkLeft == 0 {
+		if stsc == nil || it.chunk >= stbl.ChunkCount() {
+			return ErrInvalidSampleTable
+		}
+
+		for it.sci < len(stsc.FirstChunk)-1 && it.chunk+1 >= int(stsc.FirstChunk[it.sci+1]) {
+			it.sci++
+		}
+
+		if it.sci >= len(stsc.FirstChunk) {
+			return ErrInvalidSampleTable
+		}
+
+		it.chunkLeft = stsc.SamplesPerChunk[it.sci]
+		it.description = stsc.SampleDescriptionID[it.sci]
+		it.offset = int64(stbl.ChunkOffset(it.chunk))
+		it.chunk++
+	}
+
+	if stbl.Stts == nil {
+		return ErrInvalidSampleTable
+	}
+
+	i := it.stts.next(stbl.Stts.SampleCount)
+	if i < 0 {
+		return ErrInvalidSampleTable
+	}
+
+	it.s = Sample{
+		Index:            it.next,
+		Offset:           it.offset,
+		Size:             stbl.Stsz.GetSampleSize(int(it.next)),
+		DTS:              it.dts,
+		PTS:              int64(it.dts),
+		Duration:         stbl.Stts.SampleTimeDelta[i],
+		IsSync:           true,
+		DescriptionIndex: it.description,
+	}
+
+	if ctts := stbl.Ctts; ctts != nil {
+		if i := it.ctts.next(ctts.SampleCount); i >= 0 {
+			if ctts.Version == 1 {
+				it.s.PTS += int64(int32(ctts.SampleOffset[i]))
+			} else {
+				it.s.PTS += int64(ctts.SampleOffset[i])
+			}
+		}
+	}
+
+	if stss := stbl.Stss; stss != nil {
+		for it.stss < len(stss.SampleNumber) && stss.SampleNumber[it.stss] < it.next+1 {
+			it.stss++
+		}
+		it.s.IsSync = it.stss < len(stss.SampleNumber) && stss.SampleNumber[it.stss] == it.next+1
+	}
+
+	it.chunkLeft--
+	it.offset += int64(it.s.Size)
+	it.dts += uint64(it.s.Duration)
+
+	return nil
+}
+
+// fragmentSample reads the next sample from the movie fragments. It returns false after the last one.
+func (it *SampleIterator) fragmentSample() bool {
+	if it.t.Tkhd == nil {
+		return false
+	}
+
+	for it.frag < len(it.m.Fragments) {
+		f := it.m.Fragments[it.frag]
+
+		if it.traf >= len(f.Moof.Traf) {
+			it.frag++
+			it.traf = 0
+			continue
+		}
+
+		traf := f.Moof.Traf[it.traf]
+
+		if traf.Tfhd == nil || traf.Tfhd.TrackId != it.t.Tkhd.TrackId || it.trun >= len(traf.Trun) {
+			it.traf++
+			it.trun = 0
+			it.sample = 0
+			continue
+		}
+
+		// Entering the track fragment
+		if it.trun == 0 && it.sample == 0 {
+			it.base = trafBase(it.m, f, it.traf)
+			it.offset = it.base
+			it.defaults = trackFragmentDefaults(it.m, traf.Tfhd)
+
+			if traf.Tfdt != nil {
+				it.dts = traf.Tfdt.BaseMediaDecodeTime
+			}
+		}
+
+		trun := traf.Trun[it.trun]
+
+		if it.sample >= len(trun.Samples) {
+			it.trun++
+			it.sample = 0
+			continue
+		}
+
+		if it.sample == 0 && trun.Has(TrunDataOffsetPresent) {
+			it.offset = it.base + int64(trun.DataOffset)
+		}
+
+		it.s = trunSample(trun, it.sample, &it.defaults)
+		it.s.Index = it.next
+		it.s.Offset = it.offset
+		it.s.DTS = it.dts
+		it.s.PTS += int64(it.dts)
+
+		it.sample++
+		it.offset += int64(it.s.Size)
+		it.dts += uint64(it.s.Duration)
+
+		return true
+	}
+
+	return false
+}
+
+// trunSample returns the sample i of a track run, without position nor time
+func trunSample(trun *TrunBox, i int, d *trafDefaults) (s Sample) {
+	ts := trun.Samples[i]
+	flags := d.flags
+
+	s.Duration, s.Size = d.duration, d.size
+	s.DescriptionIndex = d.description
+
+	if trun.Has(TrunSampleDurationPresent) {
+		s.Duration = ts.Duration
+	}
+	if trun.Has(TrunSampleSizePresent) {
+		s.Size = ts.Size
+	}
+	if trun.Has(TrunSampleFlagsPresent) {
+		flags = ts.Flags
+	}
+	if i == 0 && trun.Has(TrunFirstSampleFlagsPresent) {
+		flags = trun.FirstSampleFlags
+	}
+	if trun.Has(TrunSampleCompositionTimeOffsetPresent) {
+		if trun.Version == 1 {
+			s.PTS = int64(ts.CompositionTimeOffset)
+		} else {
+			s.PTS = int64(uint32(ts.CompositionTimeOffset))
+		}
+	}
+
+	s.IsSync = flags&SampleFlagIsNonSync == 0
+
+	return
+}
+
+// trackFragmentDefaults returns the default values of the samples of a track fragment (tfhd, then trex)
+func trackFragmentDefaults(m *MP4, tfhd *TfhdBox) (d trafDefaults) {
+	if m.Moov.Mvex != nil {
+		if trex := m.Moov.Mvex.TrackExtends(tfhd.TrackId); trex != nil {
+			d = trafDefaults{
+				description: trex.DefaultSampleDescriptionIndex,
+				duration:    trex.DefaultSampleDuration,
+				size:        trex.DefaultSampleSize,
+				flags:       trex.DefaultSampleFlags,
+			}
+		}
+	}
+
+	if tfhd.Has(TfhdSampleDescriptionIndexPresent) {
+		d.description = tfhd.SampleDescriptionIndex
+	}
+	if tfhd.Has(TfhdDefaultSampleDurationPresent) {
+		d.duration = tfhd.DefaultSampleDuration
+	}
+	if tfhd.Has(TfhdDefaultSampleSizePresent) {
+		d.size = tfhd.DefaultSampleSize
+	}
+	if tfhd.Has(TfhdDefaultSampleFlagsPresent) {
+		d.flags = tfhd.DefaultSampleFlags
+	}
+
+	return
+}
+
+// trafBase returns the base data offset of the track fragment i of a fragment
+func trafBase(m *MP4, f *Fragment, i int) int64 {
+	tfhd := f.Moof.Traf[i].Tfhd
+
+	switch {
+	case tfhd != nil && tfhd.Has(TfhdBaseDataOffsetPresent):
+		return int64(tfhd.BaseDataOffset)
+	case i == 0 || tfhd == nil || tfhd.Has(TfhdDefaultBaseIsMoof):
+		return f.Offset
+	}
+
+	// End of the data of the previous track fragment
+	prev := f.Moof.Traf[i-1]
+	base := trafBase(m, f, i-1)
+	pos := base
+
+	if prev.Tfhd == nil {
+		return pos
+	}
+
+	d := trackFragmentDefaults(m, prev.Tfhd)
+
+	for _, trun := range prev.Trun {
+		if trun.Has(TrunDataOffsetPresent) {
+			pos = base + int64(trun.DataOffset)
+		}
+		for j := range trun.Samples {
+			pos += int64(trunSample(trun, j, &d).Size)
+		}
+	}
+
+	return pos
+}
+
+// seekSync moves the iterator to the last sync sample decoded at or before units (or to the first sample)
+func (it *SampleIterator) seekSync(units uint64) error {
+	start := *it
+
+	frags, timed := it.trackFragments()
+
+	if len(frags) > 0 && !timed {
+		return it.scanSync(units)
+	}
+
+	if len(frags) > 0 && (it.count == 0 || units >= frags[0].dts) {
+		k := sort.Search(len(frags), func(i int) bool { return frags[i].dts > units }) - 1
+		if k < 0 {
+			k = 0
+		}
+
+		for ; k >= 0; k-- {
+			*it = start
+			it.frag, it.traf, it.next = frags[k].frag, frags[k].traf, frags[k].index
+
+			if found := it.fragmentSync(units); found {
+				return nil
+			}
+		}
+
+		*it = start
+	}
+
+	if it.count == 0 {
+		return nil
+	}
+
+	stbl := it.t.Mdia.Minf.Stbl
+
+	if stbl.Stts == nil || stbl.Stsc == nil {
+		return ErrInvalidSampleTable
+	}
+
+	n := stbl.Stts.GetSample(units)
+	if n >= it.count {
+		n = it.count - 1
+	}
+
+	if stss := stbl.Stss; stss != nil {
+		i := sort.Search(len(stss.SampleNumber), func(i int) bool { return stss.SampleNumber[i] > n+1 }) - 1
+		if n = 0; i >= 0 && stss.SampleNumber[i] > 0 {
+			n = stss.SampleNumber[i] - 1
+		}
+	}
+
+	return it.seekTable(n)
+}
+
+// A track fragment of the track: its position, its decode time and the index of its first sample
+type fragmentPosition struct {
+	frag, traf int
+	dts        uint64
+	index      uint32
+}
+
+// trackFragments lists the track fragments of the track, and tells whether they all have a decode time
+func (it *SampleIterator) trackFragments() (l []fragmentPosition, timed bool) {
+	if it.t.Tkhd == nil {
+		return nil, false
+	}
+
+	timed = true
+	index := it.count
+
+	for i, f := range it.m.Fragments {
+		for j, traf := range f.Moof.Traf {
+			if traf.Tfhd == nil || traf.Tfhd.TrackId != it.t.Tkhd.TrackId {
+				continue
+			}
+
+			p := fragmentPosition{frag: i, traf: j, index: index}
+			if traf.Tfdt != nil {
+				p.dts = traf.Tfdt.BaseMediaDecodeTime
+			} else {
+				timed = false
+			}
+
+			for _, trun := range traf.Trun {
+				index += uint32(len(trun.Samples))
+			}
+
+			l = append(l, p)
+		}
+	}
+
+	return
+}
+
+// fragmentSync moves the iterator to the last sync sample of a track fragment decoded at or before units
+func (it *SampleIterator) fragmentSync(units uint64) (found bool) {
+	frag, traf := it.frag, it.traf
+	sync := *it
+
+	for {
+		prev := *it
+		if !it.Next() || it.frag != frag || it.traf != traf || it.s.DTS > units {
+			break
+		}
+		if it.s.IsSync {
+			sync, found = prev, true
+		}
+	}
+
+	*it = sync
+
+	return
+}
+
+// scanSync moves the iterator to the last sync sample decoded at or before units, listing the samples
+func (it *SampleIterator) scanSync(units uint64) error {
+	sync := *it
+
+	for {
+		prev := *it
+		if !it.Next() || it.s.DTS > units {
+			break
+		}
+		if it.s.IsSync {
+			sync = prev
+		}
+	}
+
+	if err := it.err; err != nil {
+		return err
+	}
+
+	*it = sync
+
+	return nil
+}
+
+// seekTable moves the iterator to the sample n of the sample table
+func (it *SampleIterator) seekTable(n uint32) error {
+	stbl := it.t.Mdia.Minf.Stbl
+	stsc := stbl.Stsc
+	chunks := stbl.ChunkCount()
+
+	// The chunk holding the sample, first being the index of its first sample
+	var first uint32
+
+	chunk, sci := 0, 0
+
+	for {
+		if chunk >= chunks || len(stsc.FirstChunk) == 0 {
+			return ErrInvalidSampleTable
+		}
+
+		for sci < len(stsc.FirstChunk)-1 && chunk+1 >= int(stsc.FirstChunk[sci+1]) {
+			sci++
+		}
+
+		end := chunks
+		if sci < len(stsc.FirstChunk)-1 && int(stsc.FirstChunk[sci+1])-1 < end {
+			end = int(stsc.FirstChunk[sci+1]) - 1
+		}
+
+		spc := uint64(stsc.SamplesPerChunk[sci])
+
+		if held := uint64(end-chunk) * spc; uint64(n-first) < held {
+			k := uint64(n-first) / spc
+			chunk += int(k)
+			first += uint32(k * spc)
+			break
+		} else {
+			first += uint32(held)
+			chunk = end
+		}
+	}
+
+	it.chunk = chunk + 1
+	it.sci = sci
+	it.chunkLeft = stsc.SamplesPerChunk[sci] - (n - first)
+	it.description = stsc.SampleDescriptionID[sci]
+	it.offset = int64(stbl.ChunkOffset(chunk))
+
+	for i := first; i < n; i++ {
+		it.offset += int64(stbl.Stsz.GetSampleSize(int(i)))
+	}
+
+	// The decode time of the sample, and the positions in the run-length tables
+	it.dts = 0
+	it.stts = seekRun(stbl.Stts.SampleCount, n)
+
+	for i := 0; i < it.stts.i && i < len(stbl.Stts.SampleCount); i++ {
+		it.dts += uint64(stbl.Stts.SampleCount[i]) * uint64(stbl.Stts.SampleTimeDelta[i])
+	}
+	if it.stts.i < len(stbl.Stts.SampleCount) {
+		it.dts += uint64(it.stts.n) * uint64(stbl.Stts.SampleTimeDelta[it.stts.i])
+	}
+
+	if ctts := stbl.Ctts; ctts != nil {
+		it.ctts = seekRun(ctts.SampleCount, n)
+	}
+
+	if stss := stbl.Stss; stss != nil {
+		it.stss = sort.Search(len(stss.SampleNumber), func(i int) bool { return stss.SampleNumber[i] >= n+1 })
+	}
+
+	it.next = n
+
+	return nil
+}
+
+// seekRun returns the position of the sample n in a run-length table
+func seekRun(counts []uint32, n uint32) runCursor {
+	for i, c := range counts {
+		if n < c {
+			return runCursor{i: i, n: n}
+		}
+		n -= c
+	}
+	return runCursor{i: len(counts)}
+}
@@ -0,0 +1,111 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+// tableSamples lists the samples of a sample table, expanding each table
+func tableSamples(stbl *StblBox) (l []Sample) {
+	var dts uint64
+
+	for i := range stbl.Stts.SampleCount {
+		for j := uint32(0); j < stbl.Stts.SampleCount[i]; j++ {
+			l = append(l, Sample{Index: uint32(len(l)), DTS: dts, PTS: int64(dts), Duration: stbl.Stts.SampleTimeDelta[i], IsSync: stbl.Stss == nil})
+			dts += uint64(stbl.Stts.SampleTimeDelta[i])
+		}
+	}
+
+	if stbl.Ctts != nil {
+		for i := range l {
+			l[i].PTS += stbl.Ctts.GetOffset(uint32(i))
+		}
+	}
+
+	if stbl.Stss != nil {
+		for _, n := range stbl.Stss.SampleNumber {
+			l[n-1].IsSync = true
+		}
+	}
+
+	n := 0
+	stsc := stbl.Stsc
+
+	for c, offset := range stbl.ChunkOffsets() {
+		e := 0
+		for e < len(stsc.FirstChunk)-1 && int(stsc.FirstChunk[e+1]) <= c+1 {
+			e++
+		}
+
+		for j := uint32(0); j < stsc.SamplesPerChunk[e]; j, n = j+1, n+1 {
+			l[n].Offset = int64(offset)
+			l[n].Size = stbl.Stsz.GetSampleSize(n)
+			l[n].DescriptionIndex = stsc.SampleDescriptionID[e]
+			offset += uint64(l[n].Size)
+		}
+	}
+
+	return l
+}
+
+// inFragment tells whether the data of a sample is in the media data box of a fragment
+func inFragment(m *MP4, s Sample) bool {
+	for _, f := range m.Fragments {
+		if f.Mdat != nil && s.Offset >= f.Mdat.Offset && s.Offset+int64(s.Size) <= f.Mdat.Offset+int64(f.Mdat.Size()) {
+			return true
+		}
+	}
+	return false
+}
+
+// TestSampleIterator compares the samples listed by an iterator with the expanded sample tables, and checks
+// the samples of the movie fragments
+func TestSampleIterator(t *testing.T) {
+	for name, src := range testFiles(t) {
+		m, err := DecodeSeeker(bytes.NewReader(src))
+		if err != nil {
+			t.Fatal(name, err)
+		}
+
+		for _, trak := range m.Moov.Trak {
+			var got []Sample
+
+			it := m.Samples(trak)
+			for it.Next() {
+				got = append(got, it.Sample())
+			}
+
+			if it.Err() != nil {
+				t.Fatal(name, it.Err())
+			}
+
+			if len(m.Fragments) == 0 {
+				want := tableSamples(trak.Mdia.Minf.Stbl)
+
+				if len(got) != len(want) {
+					t.Fatalf("%s: track %d: got %d samples, want %d", name, trak.Tkhd.TrackId, len(got), len(want))
+				}
+
+				for i := range want {
+					if got[i] != want[i] {
+						t.Fatalf("%s: track %d: got sample %+v, want %+v", name, trak.Tkhd.TrackId, got[i], want[i])
+					}
+				}
+
+				continue
+			}
+
+			// The samples of the fragments follow each other in decoding time and in the media data of each
+			// fragment, the video key frames every second
+			for i, s := range got {
+				if i > 0 && (s.DTS != got[i-1].DTS+uint64(got[i-1].Duration) || s.Index != uint32(i)) {
+					t.Fatalf("%s: track %d: sample %d doesn't follow the previous one", name, trak.Tkhd.TrackId, i)
+				}
+
+				if !inFragment(m, s) || s.IsSync != (trak.Kind() == TrackAudio || i%25 == 0) {
+					t.Fatalf("%s: track %d: invalid sample %+v", name, trak.Tkhd.TrackId, s)
+				}
+			}
+		}
+	}
+}
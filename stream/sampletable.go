@@ -0,0 +1,127 @@
+package stream
+
+// SampleTableBuilder builds the sample table (stbl) of a track, sample by sample and chunk by chunk
+//
+// Samples are added in decoding order with AddSample, then grouped into chunks with AddChunk. Build
+// returns the sample table, using the most compact form of each box.
+type SampleTableBuilder struct {
+	durations   []uint32
+	offsets     []int32
+	sizes       []uint32
+	sync        []uint32
+	allSync     bool
+	duration    uint64
+	chunks      []uint64
+	chunkCounts []uint32
+	chunkDescs  []uint32
+	chunked     uint32
+}
+
+// NewSampleTableBuilder returns an empty sample table builder
+func NewSampleTableBuilder() *SampleTableBuilder {
+	return &SampleTableBuilder{
+		allSync: true,
+	}
+}
+
+// AddSample adds a sample. compositionOffset is the difference between its presentation and decoding times.
+func (b *SampleTableBuilder) AddSample(duration uint32, compositionOffset int32, size uint32, sync bool) {
+	b.durations = append(b.durations, duration)
+	b.offsets = append(b.offsets, compositionOffset)
+	b.sizes = append(b.sizes, size)
+	b.duration += uint64(duration)
+
+	if sync {
+		b.sync = append(b.sync, uint32(len(b.sizes)))
+	} else {
+		b.allSync = false
+	}
+}
+
+// AddChunk adds a chunk at the given offset, holding the next samples (in the order they were added)
+func (b *SampleTableBuilder) AddChunk(offset uint64, samples uint32, descriptionIndex uint32) {
+	b.chunks = append(b.chunks, offset)
+	b.chunkCounts = append(b.chunkCounts, samples)
+	b.chunkDescs = append(b.chunkDescs, descriptionIndex)
+	b.chunked += samples
+}
+
+// SampleCount returns the number of samples added
+func (b *SampleTableBuilder) SampleCount() uint32 {
+	return uint32(len(b.sizes))
+}
+
+// ChunkedSamples returns the number of samples already grouped into chunks
+func (b *SampleTableBuilder) ChunkedSamples() uint32 {
+	return b.chunked
+}
+
+// Duration returns the sum of the durations of the samples added
+func (b *SampleTableBuilder) Duration() uint64 {
+	return b.duration
+}
+
+// Build returns the sample table, with the given sample descriptions
+func (b *SampleTableBuilder) Build(stsd *StsdBox) *StblBox {
+	stbl := &StblBox{
+		Stsd: stsd,
+		Stts: &SttsBox{},
+		Stsc: &StscBox{},
+		Stsz: NewStszBox(b.sizes),
+	}
+
+	// stts - run length encoded durations
+	for i, d := range b.durations {
+		if n := len(stbl.Stts.SampleCount); i > 0 && stbl.Stts.SampleTimeDelta[n-1] == d {
+			stbl.Stts.SampleCount[n-1]++
+			continue
+		}
+		stbl.Stts.SampleCount = append(stbl.Stts.SampleCount, 1)
+		stbl.Stts.SampleTimeDelta = append(stbl.Stts.SampleTimeDelta, d)
+	}
+
+	// ctts - only when presentation and decoding times differ, signed offsets need version 1
+	for _, o := range b.offsets {
+		if o == 0 {
+			continue
+		}
+		if stbl.Ctts == nil {
+			stbl.Ctts = &CttsBox{}
+		}
+		if o < 0 {
+			stbl.Ctts.Version = 1
+		}
+	}
+
+	if stbl.Ctts != nil {
+		for i, o := range b.offsets {
+			if n := len(stbl.Ctts.SampleCount); i > 0 && stbl.Ctts.SampleOffset[n-1] == uint32(o) {
+				stbl.Ctts.SampleCount[n-1]++
+				continue
+			}
+			stbl.Ctts.SampleCount = append(stbl.Ctts.SampleCount, 1)
+			stbl.Ctts.SampleOffset = append(stbl.Ctts.SampleOffset, uint32(o))
+		}
+	}
+
+	// stss - absent when all samples are sync samples
+	if !b.allSync {
+		stbl.Stss = &StssBox{
+			SampleNumber: append([]uint32(nil), b.sync...),
+		}
+	}
+
+	// stsc - a new entry when the samples per chunk or the description change
+	for i := range b.chunks {
+		if n := len(stbl.Stsc.FirstChunk); n > 0 && stbl.Stsc.SamplesPerChunk[n-1] == b.chunkCounts[i] && stbl.Stsc.SampleDescriptionID[n-1] == b.chunkDescs[i] {
+			continue
+		}
+		stbl.Stsc.FirstChunk = append(stbl.Stsc.FirstChunk, uint32(i+1))
+		stbl.Stsc.SamplesPerChunk = append(stbl.Stsc.SamplesPerChunk, b.chunkCounts[i])
+		stbl.Stsc.SampleDescriptionID = append(stbl.Stsc.SampleDescriptionID, b.chunkDescs[i])
+	}
+
+	stbl.SetChunkOffsets(b.chunks)
+
+	return stbl
+}
@@ -0,0 +1,281 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+var (
+	ErrNoFragment    = errors.New("media has no fragment")
+	ErrTrackNotFound = errors.New("track not found")
+)
+
+// Segment Index Box (sidx - optional)
+//
+// Status: decoded
+//
+// Indexes the subsegments of a segment (DASH, CMAF): their sizes, durations and stream access points
+// (SAP). The first subsegment begins FirstOffset bytes after the end of the box, the others follow
+// each other. A reference may point to another segment index box instead of media (ReferenceType 1).
+//
+// Times are in Timescale, usually the timescale of the track ReferenceId.
+//
+// Version 0 stores the earliest presentation time and the first offset on 32 bits, version 1 on 64 bits.
+// Version 1 is encoded when Version is 1 or when a value doesn't fit in 32 bits.
+type SidxBox struct {
+	Version                  byte
+	Flags                    [3]byte
+	header                   [8]byte
+	ReferenceId              uint32
+	Timescale                uint32
+	EarliestPresentationTime uint64
+	FirstOffset              uint64
+	References               []SidxReference
+}
+
+// A reference of a segment index box: a subsegment, or another segment index box
+type SidxReference struct {
+	ReferenceType      byte
+	ReferencedSize     uint32
+	SubsegmentDuration uint32
+	StartsWithSAP      bool
+	SAPType            byte
+	SAPDeltaTime       uint32
+}
+
+func DecodeSidx(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &SidxBox{
+		Version:     data[0],
+		Flags:       [3]byte{data[1], data[2], data[3]},
+		ReferenceId: binary.BigEndian.Uint32(data[4:8]),
+		Timescale:   binary.BigEndian.Uint32(data[8:12]),
+	}
+	data = data[12:]
+	if b.Version == 1 {
+		if len(data) < 20 {
+			return nil, ErrInvalidBoxSize
+		}
+		b.EarliestPresentationTime = binary.BigEndian.Uint64(data[0:8])
+		b.FirstOffset = binary.BigEndian.Uint64(data[8:16])
+		data = data[16:]
+	} else {
+		if len(data) < 12 {
+			return nil, ErrInvalidBoxSize
+		}
+		b.EarliestPresentationTime = uint64(binary.BigEndian.Uint32(data[0:4]))
+		b.FirstOffset = uint64(binary.BigEndian.Uint32(data[4:8]))
+		data = data[8:]
+	}
+	c := int(binary.BigEndian.Uint16(data[2:4]))
+	data = data[4:]
+	if c*12 > len(data) {
+		return nil, ErrInvalidBoxSize
+	}
+	b.References = make([]SidxReference, c)
+	for i := range b.References {
+		v := binary.BigEndian.Uint32(data[0:4])
+		s := binary.BigEndian.Uint32(data[8:12])
+		b.References[i] = SidxReference{
+			ReferenceType:      byte(v >> 31),
+			ReferencedSize:     v & 0x7fffffff,
+			SubsegmentDuration: binary.BigEndian.Uint32(data[4:8]),
+			StartsWithSAP:      s>>31 == 1,
+			SAPType:            byte(s>>28) & 7,
+			SAPDeltaTime:       s & 0x0fffffff,
+		}
+		data = data[12:]
+	}
+	return b, nil
+}
+
+func (b *SidxBox) Type() string {
+	return "sidx"
+}
+
+func (b *SidxBox) version() byte {
+	if b.Version == 1 || b.EarliestPresentationTime > math.MaxUint32 || b.FirstOffset > math.MaxUint32 {
+		return 1
+	}
+	return 0
+}
+
+func (b *SidxBox) Size() int {
+	sz := BoxHeaderSize + 24 + 12*len(b.References)
+	if b.version() == 1 {
+		sz += 8
+	}
+	return sz
+}
+
+// Duration returns the sum of the durations of the references, in the timescale of the box
+func (b *SidxBox) Duration() (d uint64) {
+	for _, r := range b.References {
+		d += uint64(r.SubsegmentDuration)
+	}
+	return
+}
+
+func (b *SidxBox) Dump() {
+	fmt.Printf("Segment index: reference %d, timescale %d, earliest presentation time %d, first offset %d\n", b.ReferenceId, b.Timescale, b.EarliestPresentationTime, b.FirstOffset)
+	for i, r := range b.References {
+		fmt.Printf(" #%d type %d, size %d, duration %d, SAP %t type %d delta %d\n", i, r.ReferenceType, r.ReferencedSize, r.SubsegmentDuration, r.StartsWithSAP, r.SAPType, r.SAPDeltaTime)
+	}
+}
+
+func (b *SidxBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.version()
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.ReferenceId)
+	binary.BigEndian.PutUint32(buf[8:], b.Timescale)
+	data := buf[12:]
+	if buf[0] == 1 {
+		binary.BigEndian.PutUint64(data[0:], b.EarliestPresentationTime)
+		binary.BigEndian.PutUint64(data[8:], b.FirstOffset)
+		data = data[16:]
+	} else {
+		binary.BigEndian.PutUint32(data[0:], uint32(b.EarliestPresentationTime))
+		binary.BigEndian.PutUint32(data[4:], uint32(b.FirstOffset))
+		data = data[8:]
+	}
+	binary.BigEndian.PutUint16(data[2:], uint16(len(b.References)))
+	data = data[4:]
+	for _, r := range b.References {
+		s := uint32(r.SAPType&7)<<28 | r.SAPDeltaTime&0x0fffffff
+		if r.StartsWithSAP {
+			s |= 1 << 31
+		}
+		binary.BigEndian.PutUint32(data[0:], uint32(r.ReferenceType)<<31|r.ReferencedSize&0x7fffffff)
+		binary.BigEndian.PutUint32(data[4:], r.SubsegmentDuration)
+		binary.BigEndian.PutUint32(data[8:], s)
+		data = data[12:]
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// SegmentIndex computes the segment index box (sidx) of a track of a fragmented media, a subsegment
+// being a movie fragment: from its moof box up to the next one (or the end of its mdat box). The
+// fragments without samples of the track are merged into the preceding subsegment (into the following one
+// at the beginning of the media).
+//
+// The earliest presentation time is the one of the first sample of the track in the fragments, the
+// edit list being not applied. FirstOffset is 0: the box is meant to be placed just before the first
+// moof box.
+func (m *MP4) SegmentIndex(trackId uint32) (*SidxBox, error) {
+	var trak *TrakBox
+
+	for _, t := range m.Moov.Trak {
+		if t.Tkhd != nil && t.Tkhd.TrackId == trackId {
+			trak = t
+			break
+		}
+	}
+
+	if trak == nil {
+		return nil, ErrTrackNotFound
+	}
+
+	if len(m.Fragments) == 0 {
+		return nil, ErrNoFragment
+	}
+
+	sidx := &SidxBox{
+		ReferenceId: trackId,
+		Timescale:   trak.Mdia.Mdhd.Timescale,
+		References:  make([]SidxReference, len(m.Fragments)),
+	}
+
+	for i, f := range m.Fragments {
+		end := f.Offset + int64(f.Moof.Size())
+
+		if i+1 < len(m.Fragments) {
+			end = m.Fragments[i+1].Offset
+		} else if f.Mdat != nil {
+			end = f.Mdat.Offset + int64(f.Mdat.Size())
+		}
+
+		sidx.References[i].ReferencedSize = uint32(end - f.Offset)
+	}
+
+	var ept int64
+
+	seen := make([]bool, len(m.Fragments))
+	first := true
+
+	it := m.Samples(trak)
+	for it.Next() {
+		// Samples of the sample table
+		if it.next <= it.count {
+			continue
+		}
+
+		s := it.Sample()
+		r := &sidx.References[it.frag]
+
+		if !seen[it.frag] {
+			seen[it.frag] = true
+			r.StartsWithSAP = s.IsSync
+			if s.IsSync {
+				r.SAPType = 1
+			}
+		}
+
+		r.SubsegmentDuration += s.Duration
+
+		if first || s.PTS < ept {
+			ept = s.PTS
+			first = false
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	// Fragments without samples of the track
+	var size uint32
+
+	l := sidx.References[:0]
+
+	for i, r := range sidx.References {
+		switch {
+		case seen[i]:
+			r.ReferencedSize += size
+			size = 0
+			l = append(l, r)
+		case len(l) > 0:
+			l[len(l)-1].ReferencedSize += r.ReferencedSize
+		default:
+			size += r.ReferencedSize
+		}
+	}
+
+	if len(l) == 0 {
+		return nil, ErrNoFragment
+	}
+
+	sidx.References = l
+
+	if ept > 0 {
+		sidx.EarliestPresentationTime = uint64(ept)
+	}
+
+	return sidx, nil
+}
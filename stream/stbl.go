@@ -1,26 +1,31 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
+	"math"
 )
 
 // Soample Table Box (stbl - mandatory)
 //
 // Contained in : Media Information Box (minf)
 //
-// Status: partially decoded (anything other than stsd, stts, stsc, stss, stsz, stco, ctts is ignored)
+// Status: partially decoded (anything other than stsd, stts, stsc, stss, stsz, stco, co64, ctts is ignored)
 //
 // The table contains all information relevant to data samples (times, chunks, sizes, ...)
+//
+// Chunk offsets are stored either in a stco box or, for offsets larger than 4GiB, in a co64 box.
+// ChunkCount, ChunkOffset and SetChunkOffsets give access to both.
 type StblBox struct {
-	Stts   *SttsBox
-	Stss   *StssBox
-	Stsc   *StscBox
-	Stsz   *StszBox
-	Stco   *StcoBox
-	Ctts   *CttsBox
-	boxes  []Box
-	header [8]byte
+	Stsd  *StsdBox
+	Stts  *SttsBox
+	Stss  *StssBox
+	Stsc  *StscBox
+	Stsz  *StszBox
+	Stco  *StcoBox
+	Co64  *Co64Box
+	Ctts  *CttsBox
+	boxes []Box
+	order []Box
 }
 
 func DecodeStbl(r io.Reader) (Box, error) {
@@ -28,60 +33,75 @@ func DecodeStbl(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	s := &StblBox{
-		boxes: make([]Box, 0, len(l)),
-	}
-	for _, b := range l {
-		switch b.Type() {
-		case "stts":
-			s.Stts = b.(*SttsBox)
-		case "stsc":
-			s.Stsc = b.(*StscBox)
-		case "stss":
-			s.Stss = b.(*StssBox)
-		case "stsz":
-			s.Stsz = b.(*StszBox)
-		case "stco":
-			s.Stco = b.(*StcoBox)
-		case "ctts":
-			s.Ctts = b.(*CttsBox)
-		default:
-			s.boxes = append(s.boxes, b)
-		}
+	s := &StblBox{}
+	s.SetChildren(l)
+	switch {
+	case s.Stsd == nil:
+		return nil, missingBox("stsd")
+	case s.Stts == nil:
+		return nil, missingBox("stts")
+	case s.Stsc == nil:
+		return nil, missingBox("stsc")
+	case s.Stsz == nil && !hasBox(s.boxes, "stz2"):
+		return nil, missingBox("stsz")
+	case s.Stco == nil && s.Co64 == nil:
+		return nil, missingBox("stco")
+	}
+	if !s.sampleCountValid() {
+		return nil, ErrInvalidSampleTable
 	}
 	return s, nil
 }
 
+// sampleCountValid tells whether the samples of the sample size box (stsz) are all timed by the stts box
+// and held by the chunks of the stsc box: the sample count isn't trusted otherwise.
+func (b *StblBox) sampleCountValid() bool {
+	if b.Stsz == nil {
+		return true
+	}
+
+	var timed, held uint64
+
+	for _, n := range b.Stts.SampleCount {
+		timed += uint64(n)
+	}
+
+	// The entries of the stsc box describe the chunks from their first chunk to the first chunk of the next
+	// entry (the first entry describing the first chunks)
+	chunks := uint64(b.ChunkCount())
+
+	for i, n := range b.Stsc.SamplesPerChunk {
+		first, last := uint64(1), chunks
+		if i > 0 {
+			first = uint64(b.Stsc.FirstChunk[i])
+		}
+		if i+1 < len(b.Stsc.FirstChunk) {
+			if next := uint64(b.Stsc.FirstChunk[i+1]); next > 0 && next <= last {
+				last = next - 1
+			}
+		}
+		if first <= last {
+			held += (last - first + 1) * uint64(n)
+		}
+	}
+
+	count := uint64(b.Stsz.SampleNumber)
+
+	return count <= timed && count <= held
+}
+
 func (b *StblBox) Type() string {
 	return "stbl"
 }
 
-func (b *StblBox) Size() (sz int) {
-	if b.Stts != nil {
-		sz += b.Stts.Size()
-	}
-	if b.Stss != nil {
-		sz += b.Stss.Size()
-	}
-	if b.Stsc != nil {
-		sz += b.Stsc.Size()
-	}
-	if b.Stsz != nil {
-		sz += b.Stsz.Size()
-	}
-	if b.Stco != nil {
-		sz += b.Stco.Size()
-	}
-	if b.Ctts != nil {
-		sz += b.Ctts.Size()
-	}
-	for _, box := range b.boxes {
-		sz += box.Size()
-	}
-	return sz + BoxHeaderSize
+func (b *StblBox) Size() int {
+	return boxSize(boxesSize(b.children()))
 }
 
 func (b *StblBox) Dump() {
+	if b.Stsd != nil {
+		b.Stsd.Dump()
+	}
 	if b.Stsc != nil {
 		b.Stsc.Dump()
 	}
@@ -94,44 +114,205 @@ func (b *StblBox) Dump() {
 	if b.Stco != nil {
 		b.Stco.Dump()
 	}
+	if b.Co64 != nil {
+		b.Co64.Dump()
+	}
 }
 
 func (b *StblBox) Encode(w io.Writer) error {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err := w.Write(b.header[:])
-	if err != nil {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
 		return err
 	}
-	err = b.Stts.Encode(w)
-	if err != nil {
-		return err
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *StblBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *StblBox) SetChildren(l []Box) {
+	b.Stsd, b.Stts, b.Stsc, b.Stss, b.Stsz, b.Stco, b.Co64, b.Ctts, b.boxes = nil, nil, nil, nil, nil, nil, nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *StsdBox:
+			if b.Stsd == nil {
+				b.Stsd = c
+				continue
+			}
+		case *SttsBox:
+			if b.Stts == nil {
+				b.Stts = c
+				continue
+			}
+		case *StscBox:
+			if b.Stsc == nil {
+				b.Stsc = c
+				continue
+			}
+		case *StssBox:
+			if b.Stss == nil {
+				b.Stss = c
+				continue
+			}
+		case *StszBox:
+			if b.Stsz == nil {
+				b.Stsz = c
+				continue
+			}
+		case *StcoBox:
+			if b.Stco == nil {
+				b.Stco = c
+				continue
+			}
+		case *Co64Box:
+			if b.Co64 == nil {
+				b.Co64 = c
+				continue
+			}
+		case *CttsBox:
+			if b.Ctts == nil {
+				b.Ctts = c
+				continue
+			}
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *StblBox) children() []Box {
+	var l []Box
+	if b.Stsd != nil {
+		l = append(l, b.Stsd)
+	}
+	if b.Stts != nil {
+		l = append(l, b.Stts)
+	}
+	if b.Ctts != nil {
+		l = append(l, b.Ctts)
 	}
 	if b.Stss != nil {
-		err = b.Stss.Encode(w)
-		if err != nil {
-			return err
+		l = append(l, b.Stss)
+	}
+	if b.Stsc != nil {
+		l = append(l, b.Stsc)
+	}
+	if b.Stsz != nil {
+		l = append(l, b.Stsz)
+	}
+	if b.Stco != nil {
+		l = append(l, b.Stco)
+	}
+	if b.Co64 != nil {
+		l = append(l, b.Co64)
+	}
+	l = append(l, b.boxes...)
+	return l
+}
+
+// ChunkCount returns the number of chunks of the track, 0 without stco nor co64 box
+func (b *StblBox) ChunkCount() int {
+	if b.Co64 != nil {
+		return len(b.Co64.ChunkOffset)
+	}
+	if b.Stco == nil {
+		return 0
+	}
+	return len(b.Stco.ChunkOffset)
+}
+
+// ChunkOffset returns the offset of a chunk (starting at 0), from the stco or the co64 box. It returns 0
+// when the chunk doesn't exist.
+func (b *StblBox) ChunkOffset(i int) uint64 {
+	if i < 0 || i >= b.ChunkCount() {
+		return 0
+	}
+	if b.Co64 != nil {
+		return b.Co64.ChunkOffset[i]
+	}
+	return uint64(b.Stco.ChunkOffset[i])
+}
+
+// ChunkOffsets returns a copy of all chunk offsets
+func (b *StblBox) ChunkOffsets() []uint64 {
+	l := make([]uint64, b.ChunkCount())
+	for i := range l {
+		l[i] = b.ChunkOffset(i)
+	}
+	return l
+}
+
+// SetChunkOffsets replaces the chunk offsets.
+//
+// The 32bits stco box is used when all offsets fit in 32 bits, the co64 box otherwise.
+// Switching between both changes the size of the sample table.
+func (b *StblBox) SetChunkOffsets(l []uint64) {
+	var large bool
+
+	for _, o := range l {
+		if o > math.MaxUint32 {
+			large = true
+			break
 		}
 	}
-	err = b.Stsc.Encode(w)
-	if err != nil {
-		return err
+
+	if large {
+		if b.Co64 == nil {
+			b.Co64 = &Co64Box{}
+			if b.Stco != nil {
+				b.Co64.Version, b.Co64.Flags = b.Stco.Version, b.Stco.Flags
+			}
+		}
+		b.Co64.ChunkOffset = append(b.Co64.ChunkOffset[:0], l...)
+		b.Stco = nil
+		return
 	}
-	err = b.Stsz.Encode(w)
-	if err != nil {
-		return err
+
+	if b.Stco == nil {
+		b.Stco = &StcoBox{}
+		if b.Co64 != nil {
+			b.Stco.Version, b.Stco.Flags = b.Co64.Version, b.Co64.Flags
+		}
 	}
-	err = b.Stco.Encode(w)
-	if err != nil {
-		return err
+	b.Stco.ChunkOffset = b.Stco.ChunkOffset[:0]
+	for _, o := range l {
+		b.Stco.ChunkOffset = append(b.Stco.ChunkOffset, uint32(o))
 	}
-	for _, b := range b.boxes {
-		if err = b.Encode(w); err != nil {
-			return err
+	b.Co64 = nil
+}
+
+// RelocateChunks adds base to the chunk offsets of the tracks of a movie, base depending on the size of the
+// moov box. Offsets larger than 4GiB switch stco to co64, which grows the moov box: the offsets are computed
+// again until its size is stable. Tracks without chunk offsets are skipped.
+func RelocateChunks(moov *MoovBox, base func(moovSize int) uint64) {
+	tables := make([]*StblBox, 0, len(moov.Trak))
+	offsets := make([][]uint64, 0, len(moov.Trak))
+
+	for _, t := range moov.Trak {
+		if t.Mdia == nil || t.Mdia.Minf == nil {
+			continue
+		}
+		if stbl := t.Mdia.Minf.Stbl; stbl != nil && (stbl.Stco != nil || stbl.Co64 != nil) {
+			tables = append(tables, stbl)
+			offsets = append(offsets, stbl.ChunkOffsets())
 		}
 	}
-	if b.Ctts != nil {
-		return b.Ctts.Encode(w)
+
+	for moovSize := 0; moovSize != moov.Size(); {
+		moovSize = moov.Size()
+
+		delta := base(moovSize)
+
+		for i, stbl := range tables {
+			l := make([]uint64, len(offsets[i]))
+			for j, o := range offsets[i] {
+				l[j] = o + delta
+			}
+			stbl.SetChunkOffsets(l)
+		}
 	}
-	return nil
 }
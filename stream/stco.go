@@ -12,7 +12,7 @@ import (
 //
 // Status: decoded
 //
-// This is the 32bits version of the box, the 64bits version (co64) is not decoded.
+// This is the 32bits version of the box, see Co64Box for the 64bits version.
 //
 // The table contains the offsets (starting at the beginning of the file) for each chunk of data for the current track.
 // A chunk contains samples, the table defining the allocation of samples to each chunk is stsc.
@@ -30,7 +30,14 @@ func DecodeStco(r io.Reader) (Box, error) {
 		return nil, err
 	}
 
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
 	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*4 > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
 	b := &StcoBox{
 		Flags:       [3]byte{data[1], data[2], data[3]},
 		Version:     data[0],
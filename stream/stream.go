@@ -1,10 +1,16 @@
 package stream
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"time"
 )
 
+var (
+	ErrNoMoov = errors.New("moov box not found")
+)
+
 // A MPEG-4 media
 //
 // A MPEG-4 media contains three main boxes :
@@ -13,11 +19,37 @@ import (
 //   moov : the movie box (meta-data)
 //   mdat : the media data (chunks and samples)
 //
-// Other boxes can also be present (pdin, moof, mfra, free, ...), but are not decoded.
+// Other boxes can also be present (pdin, mfra, free, ...), but are not decoded.
+//
+// Encode writes the boxes in the order they were decoded, the ftyp box always being first.
+//
+// A fragmented media (fMP4, DASH, CMAF) has a mvex box in its moov box, and its samples are described
+// by movie fragments: moof boxes, each followed by its mdat box. They are listed in Fragments. The moov
+// box of a fragmented media usually describes no samples, and it may have no mdat box of its own.
+//
+// Decode reads the media as a stream and stops at the mdat box, so the moov box must come first.
+// Medias having the moov box at the end (non-faststart files) are decoded with DecodeSeeker or DecodeReaderAt,
+// as well as fragmented medias (Decode stops at the mdat box of the first fragment).
+//
+// The lengths and counts of the boxes are checked while decoding: an invalid or truncated box makes the
+// decoding functions return a *DecodeError, giving the path and the offset of the box.
 type MP4 struct {
-	Moov  *MoovBox
-	Mdat  *MdatBox
-	boxes []Box
+	Ftyp      *FtypBox
+	Moov      *MoovBox
+	Mdat      *MdatBox
+	Fragments []*Fragment
+	boxes     []Box
+	order     []Box
+}
+
+// A movie fragment: a moof box and the mdat box holding its samples
+//
+// Offset is the position of the moof box from the beginning of the file, the data offsets of the
+// track fragments being usually relative to it.
+type Fragment struct {
+	Moof   *MoofBox
+	Mdat   *MdatBox
+	Offset int64
 }
 
 // Decode decodes a media from a Reader
@@ -26,58 +58,293 @@ func Decode(r io.Reader) (*MP4, error) {
 	if err != nil {
 		return nil, err
 	}
-	v := &MP4{
-		boxes: make([]Box, 0, len(l)),
-	}
-	for _, b := range l {
-		switch b.Type() {
-		case "moov":
-			v.Moov = b.(*MoovBox)
-		case "mdat":
-			v.Mdat = b.(*MdatBox)
-		default:
-			v.boxes = append(v.boxes, b)
+	var off int64
+	offsets := make([]int64, len(l))
+	for i, b := range l {
+		if mdat, ok := b.(*MdatBox); ok {
+			mdat.Offset = off
+			mdat.start = off + int64(mdat.HeaderSize())
 		}
+		offsets[i] = off
+		off += int64(b.Size())
+	}
+	return newMP4(l, offsets)
+}
+
+// DecodeSeeker decodes a media from a ReadSeeker
+//
+// The content of mdat boxes is skipped by seeking, so the top-level boxes following the media data
+// (a moov box at the end of the file for example) are decoded too.
+// The mdat box keeps r and its absolute offset in the file to read the media data.
+func DecodeSeeker(r io.ReadSeeker) (*MP4, error) {
+	var l []Box
+	var off int64
+	var offsets []int64
+
+	buf := make([]byte, LargeBoxHeaderSize)
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	for {
+		ht, hs, cs, err := readHeader(r, buf)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, &DecodeError{Offset: off, Err: err}
+		}
+
+		if cs < 0 {
+			end, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			cs = end - off - int64(hs)
+			if _, err = r.Seek(off+int64(hs), io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		if ht == "mdat" {
+			l = append(l, &MdatBox{
+				ContentSize: uint64(cs),
+				Offset:      off,
+				r:           r,
+				start:       off + int64(hs),
+				seekable:    true,
+				largeHeader: hs == LargeBoxHeaderSize,
+			})
+		} else {
+			b, err := decodeBox(ht, &BoxReader{
+				Reader:     io.LimitReader(r, cs),
+				Path:       []string{ht},
+				Offset:     off,
+				HeaderSize: hs,
+			})
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, b)
+		}
+
+		offsets = append(offsets, off)
+		off += int64(hs) + cs
+
+		if _, err := r.Seek(off, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	return newMP4(l, offsets)
+}
+
+// DecodeReaderAt decodes a media of the given size from a ReaderAt (see DecodeSeeker)
+func DecodeReaderAt(r io.ReaderAt, size int64) (*MP4, error) {
+	return DecodeSeeker(io.NewSectionReader(r, 0, size))
+}
+
+// newMP4 sorts the top-level boxes of a media, offsets being their positions in the file
+func newMP4(l []Box, offsets []int64) (*MP4, error) {
+	v := &MP4{}
+	v.setChildren(l, offsets)
+	if v.Moov == nil {
+		return nil, ErrNoMoov
 	}
 	return v, nil
 }
 
+// setChildren sorts the top-level boxes of a media, offsets being the positions of the moof boxes
+func (m *MP4) setChildren(l []Box, offsets []int64) {
+	var last *Fragment
+
+	m.Ftyp, m.Moov, m.Mdat, m.Fragments = nil, nil, nil, nil
+	m.boxes = make([]Box, 0, len(l))
+	m.order = append([]Box{}, l...)
+
+	for i, b := range l {
+		switch c := b.(type) {
+		case *FtypBox:
+			if m.Ftyp == nil && c.Type() == "ftyp" {
+				m.Ftyp = c
+				continue
+			}
+		case *MoovBox:
+			if m.Moov == nil {
+				m.Moov = c
+				continue
+			}
+		case *MoofBox:
+			last = &Fragment{Moof: c, Offset: offsets[i]}
+			m.Fragments = append(m.Fragments, last)
+			continue
+		case *MdatBox:
+			if last != nil && last.Mdat == nil {
+				last.Mdat = c
+				continue
+			}
+			if last == nil && m.Mdat == nil {
+				m.Mdat = c
+				continue
+			}
+		}
+		m.boxes = append(m.boxes, b)
+	}
+}
+
 // Dump displays some information about a media
 func (m *MP4) Dump() {
+	if m.Ftyp != nil {
+		m.Ftyp.Dump()
+	}
 	m.Moov.Dump()
+	if len(m.Fragments) > 0 {
+		fmt.Println("Fragments:", len(m.Fragments))
+	}
 }
 
-// Boxes lists the top-level boxes from a media
+// Boxes lists the other top-level boxes from a media (neither ftyp, moov nor media data)
 func (m *MP4) Boxes() []Box {
 	return m.boxes
 }
 
 // Encode encodes a media to a Writer
-func (m *MP4) Encode(w io.Writer) (err error) {
-	err = m.Moov.Encode(w)
-	if err != nil {
-		return err
-	}
-	for _, b := range m.boxes {
-		err = b.Encode(w)
-		if err != nil {
+//
+// The boxes are written in the order they were decoded, the ftyp box being first: an unmodified media is
+// encoded as it was decoded. New boxes are written after the moov box, and new fragments at the end.
+func (m *MP4) Encode(w io.Writer) error {
+	for _, b := range m.Children() {
+		if err := b.Encode(w); err != nil {
 			return err
 		}
 	}
-	return m.Mdat.Encode(w)
+
+	return nil
+}
+
+// Children returns the top-level boxes of the media, in the encoding order
+func (m *MP4) Children() []Box {
+	l := orderBoxes(m.order, m.children())
+
+	for i, b := range l {
+		if b == Box(m.Ftyp) && i > 0 {
+			copy(l[1:i+1], l[:i])
+			l[0] = b
+			break
+		}
+	}
+
+	return l
+}
+
+// SetChildren replaces the top-level boxes of the media, which are encoded in the given order (the ftyp
+// box being first). The fragments keep their offsets, new fragments get their positions in l.
+func (m *MP4) SetChildren(l []Box) {
+	var pos int64
+
+	known := make(map[*MoofBox]int64, len(m.Fragments))
+	for _, f := range m.Fragments {
+		known[f.Moof] = f.Offset
+	}
+
+	offsets := make([]int64, len(l))
+	for i, b := range l {
+		offsets[i] = pos
+		if moof, ok := b.(*MoofBox); ok {
+			if o, ok := known[moof]; ok {
+				offsets[i] = o
+			}
+		}
+		pos += int64(b.Size())
+	}
+
+	m.setChildren(l, offsets)
+}
+
+// children returns the top-level boxes of the media, in the default order
+func (m *MP4) children() []Box {
+	var l []Box
+	if m.Ftyp != nil {
+		l = append(l, m.Ftyp)
+	}
+	if m.Moov != nil {
+		l = append(l, m.Moov)
+	}
+	l = append(l, m.boxes...)
+	if m.Mdat != nil {
+		l = append(l, m.Mdat)
+	}
+	for _, f := range m.Fragments {
+		l = append(l, f.Moof)
+		if f.Mdat != nil {
+			l = append(l, f.Mdat)
+		}
+	}
+	return l
 }
 
 func (m *MP4) Size() (sz int) {
+	if m.Ftyp != nil {
+		sz += m.Ftyp.Size()
+	}
+
 	sz += m.Moov.Size()
-	sz += m.Mdat.Size()
+
+	if m.Mdat != nil {
+		sz += m.Mdat.Size()
+	}
 
 	for _, b := range m.Boxes() {
 		sz += b.Size()
 	}
 
+	for _, f := range m.Fragments {
+		sz += f.Moof.Size()
+		if f.Mdat != nil {
+			sz += f.Mdat.Size()
+		}
+	}
+
 	return
 }
 
+// Duration returns the duration of the movie. For a fragmented media, it is the duration of the
+// movie extends header box (mehd) when the movie header box doesn't give it. It is 0 without movie header.
 func (m *MP4) Duration() time.Duration {
-	return time.Second * time.Duration(m.Moov.Mvhd.Duration) / time.Duration(m.Moov.Mvhd.Timescale)
+	if m.Moov == nil || m.Moov.Mvhd == nil {
+		return 0
+	}
+	d := m.Moov.Mvhd.Duration
+	if mvex := m.Moov.Mvex; d == 0 && mvex != nil && mvex.Mehd != nil {
+		d = mvex.Mehd.FragmentDuration
+	}
+	return UnitsToDuration(d, m.Moov.Mvhd.Timescale)
+}
+
+// UnitsToDuration converts time units to a duration, timescale being the number of units per second
+func UnitsToDuration(units uint64, timescale uint32) time.Duration {
+	if timescale == 0 {
+		return 0
+	}
+	ts := uint64(timescale)
+	return time.Duration(units/ts)*time.Second + time.Duration(units%ts)*time.Second/time.Duration(ts)
+}
+
+// DurationToUnits converts a duration to time units (rounded down), timescale being the number of units per second
+func DurationToUnits(d time.Duration, timescale uint32) uint64 {
+	if d <= 0 {
+		return 0
+	}
+	ts := uint64(timescale)
+	return uint64(d/time.Second)*ts + uint64(d%time.Second)*ts/uint64(time.Second)
+}
+
+// RescaleUnits converts time units from a timescale to another (rounded down)
+func RescaleUnits(units uint64, from, to uint32) uint64 {
+	if from == 0 {
+		return 0
+	}
+	f, t := uint64(from), uint64(to)
+	return units/f*t + units%f*t/f
 }
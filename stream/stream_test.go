@@ -0,0 +1,182 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testFiles returns the medias of testdata
+func testFiles(t testing.TB) map[string][]byte {
+	names, err := filepath.Glob(filepath.Join("testdata", "*.mp4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte, len(names))
+
+	for _, name := range names {
+		if files[name], err = ioutil.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return files
+}
+
+// TestEncodeIdentity checks that a media decoded then encoded without change is identical, whatever the order
+// of the boxes (free, udta and unknown boxes between the children of the containers)
+func TestEncodeIdentity(t *testing.T) {
+	files := testFiles(t)
+	if len(files) == 0 {
+		t.Fatal("no test media")
+	}
+
+	for name, src := range files {
+		m, err := DecodeSeeker(bytes.NewReader(src))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		var b bytes.Buffer
+
+		if err = m.Encode(&b); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if !bytes.Equal(b.Bytes(), src) {
+			t.Errorf("%s: the encoded media differs from the decoded one", name)
+		}
+	}
+}
+
+// TestDecodeMoovAfterMdat decodes a media whose moov box follows the media data and other boxes, from a
+// ReadSeeker and from a ReaderAt
+func TestDecodeMoovAfterMdat(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+
+	ftyp, mdat, moov := findBox(src, "ftyp"), findBox(src, "mdat"), findBox(src, "moov")
+	if ftyp != 0 || mdat < 0 || moov < mdat {
+		t.Fatal("the test media doesn't have its moov box after its mdat box")
+	}
+
+	// A free box between the media data and the moov box
+	data := append(append(append([]byte(nil), src[:moov]...), boxBytes("free", []byte("padding"))...), src[moov:]...)
+
+	for _, decode := range []func() (*MP4, error){
+		func() (*MP4, error) { return DecodeSeeker(bytes.NewReader(data)) },
+		func() (*MP4, error) { return DecodeReaderAt(bytes.NewReader(data), int64(len(data))) },
+	} {
+		m, err := decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if m.Ftyp == nil || m.Moov == nil || len(m.Moov.Trak) != 2 || len(m.Boxes()) != 1 || m.Boxes()[0].Type() != "free" {
+			t.Fatal("missing boxes")
+		}
+
+		if m.Mdat == nil || m.Mdat.Offset != int64(mdat) || m.Mdat.Size() != moov-mdat {
+			t.Fatalf("got media data at %d, want %d", m.Mdat.Offset, mdat)
+		}
+
+		// The sample data is read from the mdat reader, at the chunk offsets
+		it := m.Samples(m.Moov.Trak[0])
+		if !it.Next() {
+			t.Fatal(it.Err())
+		}
+
+		s := it.Sample()
+		buf := make([]byte, s.Size)
+
+		r := m.Mdat.Reader().(io.ReadSeeker)
+		if _, err = r.Seek(s.Offset, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, data[s.Offset:s.Offset+int64(s.Size)]) {
+			t.Fatal("can't read the first sample from the media data")
+		}
+
+		var b bytes.Buffer
+
+		if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), data) {
+			t.Fatalf("the encoded media differs from the decoded one (%v)", err)
+		}
+	}
+}
+
+// TestDecodeBoxSizes decodes boxes with a 64 bits size (largesize) and boxes with a size of 0, which extend
+// to the end of the file or of their container
+func TestDecodeBoxSizes(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+
+	mdat, moov := findBox(src, "mdat"), findBox(src, "moov")
+	ftyp, content, moovBox := src[:mdat], src[mdat+BoxHeaderSize:moov], src[moov:]
+
+	large := append([]byte{0, 0, 0, 1, 'm', 'd', 'a', 't'}, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(large[8:], uint64(LargeBoxHeaderSize+len(content)))
+
+	// An unknown box of size 0 ends the moov box
+	zzzz := []byte{0, 0, 0, 0, 'z', 'z', 'z', 'z', 1, 2, 3, 4, 5}
+	moovZ := boxBytes("moov", moovBox[BoxHeaderSize:], zzzz)
+
+	join := func(l ...[]byte) (b []byte) {
+		for _, p := range l {
+			b = append(b, p...)
+		}
+		return
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		headerSize int
+		encoded    []byte // the encoded media, when it differs from data
+	}{
+		{name: "largesize", data: join(ftyp, large, content, moovBox), headerSize: LargeBoxHeaderSize},
+		{name: "mdat to the end of the file", data: join(ftyp, moovBox, []byte{0, 0, 0, 0, 'm', 'd', 'a', 't'}, content), headerSize: BoxHeaderSize,
+			encoded: join(ftyp, moovBox, boxBytes("mdat", content))},
+		{name: "box to the end of its container", data: join(ftyp, moovZ, boxBytes("mdat", content)), headerSize: BoxHeaderSize,
+			encoded: join(ftyp, boxBytes("moov", moovBox[BoxHeaderSize:], boxBytes("zzzz", zzzz[BoxHeaderSize:])), boxBytes("mdat", content))},
+	}
+
+	for _, tt := range tests {
+		m, err := DecodeSeeker(bytes.NewReader(tt.data))
+		if err != nil {
+			t.Fatal(tt.name, err)
+		}
+
+		if m.Moov == nil || len(m.Moov.Trak) != 2 || m.Mdat == nil || m.Mdat.HeaderSize() != tt.headerSize || m.Mdat.ContentSize != uint64(len(content)) {
+			t.Fatalf("%s: invalid moov or mdat box", tt.name)
+		}
+
+		if tt.encoded == nil {
+			tt.encoded = tt.data
+		}
+
+		var b bytes.Buffer
+
+		if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), tt.encoded) {
+			t.Fatalf("%s: unexpected encoded media (%v)", tt.name, err)
+		}
+	}
+
+	// Decoded without seeking, the size of the last mdat box isn't known: it is encoded with a size of 0
+	data := tests[1].data
+
+	m, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+
+	if err = m.Encode(&b); err != nil || !bytes.Equal(b.Bytes(), data) {
+		t.Fatalf("the encoded media differs from the decoded one (%v)", err)
+	}
+}
@@ -0,0 +1,434 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Sample Description Box (stsd - mandatory)
+//
+// Contained in : Sample Table box (stbl)
+//
+// Status: decoded
+//
+// The table lists the sample entries (codings) of the track, referred to by the sample to chunk box (stsc).
+// Video and audio entries are decoded unless a decoder is registered for them, others are kept as *UniBox.
+type StsdBox struct {
+	Version byte
+	Flags   [3]byte
+	header  [8]byte
+	Entries []Box
+}
+
+var (
+	visualSampleEntries = map[string]bool{
+		"avc1": true, "avc2": true, "avc3": true, "avc4": true,
+		"hvc1": true, "hev1": true, "dvh1": true, "dvhe": true,
+		"av01": true, "vp08": true, "vp09": true, "mp4v": true,
+		"encv": true,
+	}
+	audioSampleEntries = map[string]bool{
+		"mp4a": true, "Opus": true, "ac-3": true, "ec-3": true,
+		"ac-4": true, "fLaC": true, "alac": true, ".mp3": true,
+		"enca": true,
+	}
+)
+
+func DecodeStsd(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
+	// An entry has a header at least
+	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*BoxHeaderSize > uint64(len(data)-8) {
+		c = uint32((len(data) - 8) / BoxHeaderSize)
+	}
+
+	b := &StsdBox{
+		Flags:   [3]byte{data[1], data[2], data[3]},
+		Version: data[0],
+		Entries: make([]Box, 0, c),
+	}
+
+	buf := make([]byte, LargeBoxHeaderSize)
+	br := bytes.NewReader(data[8:])
+	parent := boxReader(r)
+
+	for {
+		pos := 8 + br.Size() - int64(br.Len())
+		ht, hs, cs, err := readHeader(br, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, parent.headerError(pos, err)
+		}
+		if cs < 0 {
+			cs = int64(br.Len())
+		}
+
+		var e Box
+		lr := parent.child(io.LimitReader(br, cs), ht, pos, hs)
+
+		if cs > int64(br.Len()) {
+			return nil, lr.decodeError(ErrInvalidBoxSize)
+		}
+
+		if e, err = decodeBoxOr(ht, lr, decodeSampleEntry); err != nil {
+			return nil, err
+		}
+
+		b.Entries = append(b.Entries, e)
+	}
+
+	return b, nil
+}
+
+// decodeSampleEntry decodes a sample entry without registered decoder
+func decodeSampleEntry(r io.Reader, ht string) (Box, error) {
+	switch {
+	case visualSampleEntries[ht]:
+		return decodeVisualSampleEntry(ht, r)
+	case audioSampleEntries[ht]:
+		return decodeAudioSampleEntry(ht, r)
+	}
+	return DecodeUni(r, ht)
+}
+
+func (b *StsdBox) Type() string {
+	return "stsd"
+}
+
+func (b *StsdBox) Size() (sz int) {
+	for _, e := range b.Entries {
+		sz += e.Size()
+	}
+	return BoxHeaderSize + 8 + sz
+}
+
+func (b *StsdBox) Dump() {
+	fmt.Println("Sample descriptions:")
+	for i, e := range b.Entries {
+		switch e := e.(type) {
+		case *VisualSampleEntry:
+			fmt.Printf(" #%d : %s %dx%d\n", i+1, e.Format, e.Width, e.Height)
+		case *AudioSampleEntry:
+			fmt.Printf(" #%d : %s %d channels, %d bits, %d Hz\n", i+1, e.Format, e.ChannelCount, e.SampleSize, e.SampleRate>>16)
+		default:
+			fmt.Printf(" #%d : %s\n", i+1, e.Type())
+		}
+	}
+}
+
+// Children returns the sample entries
+func (b *StsdBox) Children() []Box {
+	return b.Entries
+}
+
+// SetChildren replaces the sample entries
+func (b *StsdBox) SetChildren(l []Box) {
+	b.Entries = l
+}
+
+func (b *StsdBox) Encode(w io.Writer) (err error) {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	if _, err = w.Write(b.header[:]); err != nil {
+		return
+	}
+	buf := make([]byte, 8)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(b.Entries)))
+	if _, err = w.Write(buf); err != nil {
+		return
+	}
+	for _, e := range b.Entries {
+		if err = e.Encode(w); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Visual Sample Entry (avc1, hvc1, av01, vp09, ... - in stsd)
+//
+// Status: decoded
+//
+// Describes a video coding, the codec configuration (avcC, hvcC, ...) being a child box.
+type VisualSampleEntry struct {
+	Format             string
+	DataReferenceIndex uint16
+	Width, Height      uint16
+	HorizResolution    Fixed32
+	VertResolution     Fixed32
+	FrameCount         uint16
+	CompressorName     string
+	Depth              uint16
+	Boxes              []Box
+	fixed              []byte
+}
+
+const visualSampleEntrySize = 78
+
+// NewVisualSampleEntry returns a visual sample entry with the default values
+func NewVisualSampleEntry(format string, width, height uint16) *VisualSampleEntry {
+	return &VisualSampleEntry{
+		Format:             format,
+		DataReferenceIndex: 1,
+		Width:              width,
+		Height:             height,
+		HorizResolution:    0x480000,
+		VertResolution:     0x480000,
+		FrameCount:         1,
+		Depth:              0x18,
+	}
+}
+
+func decodeVisualSampleEntry(format string, r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < visualSampleEntrySize {
+		return nil, ErrInvalidBoxSize
+	}
+
+	n := int(data[42])
+	if n > 31 {
+		n = 31
+	}
+
+	e := &VisualSampleEntry{
+		Format:             format,
+		DataReferenceIndex: binary.BigEndian.Uint16(data[6:8]),
+		Width:              binary.BigEndian.Uint16(data[24:26]),
+		Height:             binary.BigEndian.Uint16(data[26:28]),
+		HorizResolution:    fixed32(data[28:32]),
+		VertResolution:     fixed32(data[32:36]),
+		FrameCount:         binary.BigEndian.Uint16(data[40:42]),
+		CompressorName:     string(data[43 : 43+n]),
+		Depth:              binary.BigEndian.Uint16(data[74:76]),
+		fixed:              data[:visualSampleEntrySize],
+	}
+
+	if e.Boxes, err = DecodeContainer(boxReader(r).content(data[visualSampleEntrySize:], visualSampleEntrySize)); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *VisualSampleEntry) Type() string {
+	return e.Format
+}
+
+func (e *VisualSampleEntry) Size() (sz int) {
+	for _, b := range e.Boxes {
+		sz += b.Size()
+	}
+	return boxSize(visualSampleEntrySize + sz)
+}
+
+// Children returns the child boxes of the sample entry
+func (e *VisualSampleEntry) Children() []Box {
+	return e.Boxes
+}
+
+// SetChildren replaces the child boxes of the sample entry
+func (e *VisualSampleEntry) SetChildren(l []Box) {
+	e.Boxes = l
+}
+
+// Box returns the first child box of a given type, or nil
+func (e *VisualSampleEntry) Box(t string) Box {
+	for _, b := range e.Boxes {
+		if b.Type() == t {
+			return b
+		}
+	}
+	return nil
+}
+
+func (e *VisualSampleEntry) Encode(w io.Writer) (err error) {
+	if err = encodeHeader(w, e.Type(), e.Size(), false); err != nil {
+		return
+	}
+
+	buf := make([]byte, visualSampleEntrySize)
+
+	if e.fixed != nil {
+		copy(buf, e.fixed)
+	} else {
+		// pre_defined = -1
+		buf[76], buf[77] = 0xff, 0xff
+	}
+
+	binary.BigEndian.PutUint16(buf[6:], e.DataReferenceIndex)
+	binary.BigEndian.PutUint16(buf[24:], e.Width)
+	binary.BigEndian.PutUint16(buf[26:], e.Height)
+	putFixed32(buf[28:], e.HorizResolution)
+	putFixed32(buf[32:], e.VertResolution)
+	binary.BigEndian.PutUint16(buf[40:], e.FrameCount)
+	binary.BigEndian.PutUint16(buf[74:], e.Depth)
+
+	if n := int(buf[42]); n > 31 || string(buf[43:43+n]) != e.CompressorName {
+		name := make([]byte, 32)
+		name[0] = byte(copy(name[1:], e.CompressorName))
+		copy(buf[42:74], name)
+	}
+
+	if _, err = w.Write(buf); err != nil {
+		return
+	}
+
+	for _, b := range e.Boxes {
+		if err = b.Encode(w); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Audio Sample Entry (mp4a, Opus, ac-3, ec-3, ... - in stsd)
+//
+// Status: decoded
+//
+// Describes an audio coding, the codec configuration (esds, dOps, ...) being a child box.
+type AudioSampleEntry struct {
+	Format             string
+	DataReferenceIndex uint16
+	Version            uint16
+	ChannelCount       uint16
+	SampleSize         uint16
+	SampleRate         Fixed32
+	Boxes              []Box
+	fixed              []byte
+}
+
+const audioSampleEntrySize = 28
+
+// NewAudioSampleEntry returns an audio sample entry with the default values
+func NewAudioSampleEntry(format string, channels uint16, sampleRate uint16) *AudioSampleEntry {
+	return &AudioSampleEntry{
+		Format:             format,
+		DataReferenceIndex: 1,
+		ChannelCount:       channels,
+		SampleSize:         16,
+		SampleRate:         Fixed32(sampleRate) << 16,
+	}
+}
+
+func decodeAudioSampleEntry(format string, r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < audioSampleEntrySize {
+		return nil, ErrInvalidBoxSize
+	}
+
+	e := &AudioSampleEntry{
+		Format:             format,
+		DataReferenceIndex: binary.BigEndian.Uint16(data[6:8]),
+		Version:            binary.BigEndian.Uint16(data[8:10]),
+		ChannelCount:       binary.BigEndian.Uint16(data[16:18]),
+		SampleSize:         binary.BigEndian.Uint16(data[18:20]),
+		SampleRate:         fixed32(data[24:28]),
+	}
+
+	n := e.fixedSize()
+	if len(data) < n {
+		return nil, ErrInvalidBoxSize
+	}
+
+	e.fixed = data[:n]
+
+	if e.Boxes, err = DecodeContainer(boxReader(r).content(data[n:], int64(n))); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *AudioSampleEntry) fixedSize() int {
+	switch e.Version {
+	case 1:
+		return audioSampleEntrySize + 16
+	case 2:
+		return audioSampleEntrySize + 36
+	}
+	return audioSampleEntrySize
+}
+
+func (e *AudioSampleEntry) Type() string {
+	return e.Format
+}
+
+func (e *AudioSampleEntry) Size() (sz int) {
+	for _, b := range e.Boxes {
+		sz += b.Size()
+	}
+	return boxSize(e.fixedSize() + sz)
+}
+
+// Children returns the child boxes of the sample entry
+func (e *AudioSampleEntry) Children() []Box {
+	return e.Boxes
+}
+
+// SetChildren replaces the child boxes of the sample entry
+func (e *AudioSampleEntry) SetChildren(l []Box) {
+	e.Boxes = l
+}
+
+// Box returns the first child box of a given type, or nil
+func (e *AudioSampleEntry) Box(t string) Box {
+	for _, b := range e.Boxes {
+		if b.Type() == t {
+			return b
+		}
+	}
+	return nil
+}
+
+func (e *AudioSampleEntry) Encode(w io.Writer) (err error) {
+	if err = encodeHeader(w, e.Type(), e.Size(), false); err != nil {
+		return
+	}
+
+	buf := make([]byte, e.fixedSize())
+	copy(buf, e.fixed)
+
+	binary.BigEndian.PutUint16(buf[6:], e.DataReferenceIndex)
+	binary.BigEndian.PutUint16(buf[8:], e.Version)
+	binary.BigEndian.PutUint16(buf[16:], e.ChannelCount)
+	binary.BigEndian.PutUint16(buf[18:], e.SampleSize)
+	putFixed32(buf[24:], e.SampleRate)
+
+	if _, err = w.Write(buf); err != nil {
+		return
+	}
+
+	for _, b := range e.Boxes {
+		if err = b.Encode(w); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -27,7 +27,14 @@ func DecodeStss(r io.Reader) (Box, error) {
 		return nil, err
 	}
 
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
 	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*4 > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
 	b := &StssBox{
 		Flags:        [3]byte{data[1], data[2], data[3]},
 		Version:      data[0],
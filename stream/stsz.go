@@ -15,6 +15,9 @@ import (
 //
 // This table lists the size of each sample. If all samples have the same size, it can be defined in the
 // SampleUniformSize attribute.
+//
+// SampleNumber is the number of samples. The table can be cut without copy: SampleStart is the index
+// of the first sample kept from the decoded table.
 type StszBox struct {
 	body   []byte
 	header [8]byte
@@ -31,27 +34,61 @@ func DecodeStsz(r io.Reader) (Box, error) {
 		return nil, err
 	}
 
+	if len(data) < 12 {
+		return nil, ErrInvalidBoxSize
+	}
+
 	b := &StszBox{
 		body:              data,
+		SampleNumber:      binary.BigEndian.Uint32(data[8:12]),
 		SampleUniformSize: binary.BigEndian.Uint32(data[4:8]),
 	}
 
+	if b.SampleUniformSize == 0 && uint64(len(data)) < 12+4*uint64(b.SampleNumber) {
+		return nil, ErrInvalidBoxSize
+	}
+
 	return b, nil
 }
 
+// NewStszBox returns a sample size box listing the given sizes. When all samples have the same
+// size, the table is replaced by SampleUniformSize.
+func NewStszBox(sizes []uint32) *StszBox {
+	b := &StszBox{
+		SampleNumber: uint32(len(sizes)),
+	}
+
+	uniform := len(sizes) > 0 && sizes[0] > 0
+	for _, s := range sizes {
+		uniform = uniform && s == sizes[0]
+	}
+
+	if uniform {
+		b.SampleUniformSize = sizes[0]
+		b.body = make([]byte, 12)
+		return b
+	}
+
+	b.body = make([]byte, 12+4*len(sizes))
+	for i, s := range sizes {
+		binary.BigEndian.PutUint32(b.body[12+4*i:], s)
+	}
+
+	return b
+}
+
 func (b *StszBox) Type() string {
 	return "stsz"
 }
 
 func (b *StszBox) Size() int {
+	if b.SampleUniformSize > 0 {
+		return BoxHeaderSize + 12
+	}
 	return BoxHeaderSize + 12 + int(b.SampleNumber)*4
 }
 
 func (b *StszBox) Encode(w io.Writer) (err error) {
-	defer func() {
-		b.body = nil
-	}()
-
 	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
 	copy(b.header[4:], b.Type())
 
@@ -59,14 +96,15 @@ func (b *StszBox) Encode(w io.Writer) (err error) {
 		return
 	}
 
-	binary.BigEndian.PutUint32(b.body[8:12], uint32(b.SampleNumber))
+	binary.BigEndian.PutUint32(b.body[4:8], b.SampleUniformSize)
+	binary.BigEndian.PutUint32(b.body[8:12], b.SampleNumber)
 
 	if _, err = w.Write(b.body[:12]); err != nil {
 		return
 	}
 
-	if b.SampleUniformSize == 0 {
-		if _, err = w.Write(b.body[12+4*b.SampleStart : 16+4*(b.SampleStart+b.SampleNumber-1)]); err != nil {
+	if b.SampleUniformSize == 0 && b.SampleNumber > 0 {
+		if _, err = w.Write(b.body[12+4*b.SampleStart : 12+4*(b.SampleStart+b.SampleNumber)]); err != nil {
 			return
 		}
 	}
@@ -80,5 +118,7 @@ func (b *StszBox) GetSampleSize(i int) uint32 {
 		return b.SampleUniformSize
 	}
 
+	i += int(b.SampleStart)
+
 	return binary.BigEndian.Uint32(b.body[(12 + 4*i):(16 + 4*i)])
 }
@@ -31,7 +31,14 @@ func DecodeStts(r io.Reader) (Box, error) {
 		return nil, err
 	}
 
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+
 	c := binary.BigEndian.Uint32(data[4:8])
+	if uint64(c)*8 > uint64(len(data)-8) {
+		return nil, ErrInvalidBoxSize
+	}
 	b := &SttsBox{
 		Flags:           [3]byte{data[1], data[2], data[3]},
 		Version:         data[0],
@@ -81,15 +88,16 @@ func (b *SttsBox) Encode(w io.Writer) error {
 	return err
 }
 
-// Find sample number by timecode in units
-func (b *SttsBox) GetSample(units uint32) (sample uint32) {
-	var fbs, fbm uint32
+// Find sample number (starting at 0) by timecode in units: the sample being decoded at that time.
+// The last sample is returned for a timecode after the end of the media.
+func (b *SttsBox) GetSample(units uint64) (sample uint32) {
+	var fbs, fbm uint64
 
 	for i := 0; i < len(b.SampleCount); i++ {
-		fbm = b.SampleCount[i] * b.SampleTimeDelta[i]
+		fbm = uint64(b.SampleCount[i]) * uint64(b.SampleTimeDelta[i])
 
 		if fbs+fbm > units {
-			return sample + (units-fbs)/b.SampleTimeDelta[i] - 1
+			return sample + uint32((units-fbs)/uint64(b.SampleTimeDelta[i]))
 		}
 
 		fbs += fbm
@@ -105,13 +113,13 @@ func (b *SttsBox) GetSample(units uint32) (sample uint32) {
 
 // GetTimeCode returns the timecode (duration since the beginning of the media)
 // of the beginning of a sample
-func (b *SttsBox) GetTimeCode(sample uint32) (units uint32) {
+func (b *SttsBox) GetTimeCode(sample uint32) (units uint64) {
 	for i := 0; sample > 0 && i < len(b.SampleCount); i++ {
 		if sample >= b.SampleCount[i] {
-			units += b.SampleCount[i] * b.SampleTimeDelta[i]
+			units += uint64(b.SampleCount[i]) * uint64(b.SampleTimeDelta[i])
 			sample -= b.SampleCount[i]
 		} else {
-			units += sample * b.SampleTimeDelta[i]
+			units += uint64(sample) * uint64(b.SampleTimeDelta[i])
 			sample = 0
 		}
 	}
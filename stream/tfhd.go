@@ -0,0 +1,152 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Flags of the track fragment header box (tfhd)
+const (
+	TfhdBaseDataOffsetPresent         = 0x000001
+	TfhdSampleDescriptionIndexPresent = 0x000002
+	TfhdDefaultSampleDurationPresent  = 0x000008
+	TfhdDefaultSampleSizePresent      = 0x000010
+	TfhdDefaultSampleFlagsPresent     = 0x000020
+	TfhdDurationIsEmpty               = 0x010000
+	TfhdDefaultBaseIsMoof             = 0x020000
+)
+
+// Track Fragment Header Box (tfhd - mandatory)
+//
+// Contained in : Track Fragment Box (traf)
+//
+// Status: decoded
+//
+// Identifies the track of a track fragment, and overrides the default values of the track extends
+// box (trex). The optional fields are present according to the flags (see Has and SetFlags).
+//
+// The data offsets of the track runs are relative to BaseDataOffset when present, else to the
+// beginning of the moof box (with TfhdDefaultBaseIsMoof, or for the first track fragment).
+type TfhdBox struct {
+	Version                byte
+	Flags                  [3]byte
+	header                 [8]byte
+	TrackId                uint32
+	BaseDataOffset         uint64
+	SampleDescriptionIndex uint32
+	DefaultSampleDuration  uint32
+	DefaultSampleSize      uint32
+	DefaultSampleFlags     uint32
+}
+
+func DecodeTfhd(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &TfhdBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+		TrackId: binary.BigEndian.Uint32(data[4:8]),
+	}
+	data = data[8:]
+	if len(data) < b.Size()-BoxHeaderSize-8 {
+		return nil, ErrInvalidBoxSize
+	}
+	if b.Has(TfhdBaseDataOffsetPresent) {
+		b.BaseDataOffset = binary.BigEndian.Uint64(data)
+		data = data[8:]
+	}
+	if b.Has(TfhdSampleDescriptionIndexPresent) {
+		b.SampleDescriptionIndex = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if b.Has(TfhdDefaultSampleDurationPresent) {
+		b.DefaultSampleDuration = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if b.Has(TfhdDefaultSampleSizePresent) {
+		b.DefaultSampleSize = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if b.Has(TfhdDefaultSampleFlagsPresent) {
+		b.DefaultSampleFlags = binary.BigEndian.Uint32(data)
+	}
+	return b, nil
+}
+
+func (b *TfhdBox) Type() string {
+	return "tfhd"
+}
+
+// Has returns true when a flag is set
+func (b *TfhdBox) Has(flag uint32) bool {
+	return flags24(b.Flags)&flag != 0
+}
+
+// SetFlags sets (or clears) flags
+func (b *TfhdBox) SetFlags(flag uint32, set bool) {
+	if set {
+		b.Flags = putFlags24(flags24(b.Flags) | flag)
+	} else {
+		b.Flags = putFlags24(flags24(b.Flags) &^ flag)
+	}
+}
+
+func (b *TfhdBox) Size() int {
+	sz := BoxHeaderSize + 8
+	if b.Has(TfhdBaseDataOffsetPresent) {
+		sz += 8
+	}
+	if b.Has(TfhdSampleDescriptionIndexPresent) {
+		sz += 4
+	}
+	if b.Has(TfhdDefaultSampleDurationPresent) {
+		sz += 4
+	}
+	if b.Has(TfhdDefaultSampleSizePresent) {
+		sz += 4
+	}
+	if b.Has(TfhdDefaultSampleFlagsPresent) {
+		sz += 4
+	}
+	return sz
+}
+
+func (b *TfhdBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.TrackId)
+	p := buf[8:]
+	if b.Has(TfhdBaseDataOffsetPresent) {
+		binary.BigEndian.PutUint64(p, b.BaseDataOffset)
+		p = p[8:]
+	}
+	if b.Has(TfhdSampleDescriptionIndexPresent) {
+		binary.BigEndian.PutUint32(p, b.SampleDescriptionIndex)
+		p = p[4:]
+	}
+	if b.Has(TfhdDefaultSampleDurationPresent) {
+		binary.BigEndian.PutUint32(p, b.DefaultSampleDuration)
+		p = p[4:]
+	}
+	if b.Has(TfhdDefaultSampleSizePresent) {
+		binary.BigEndian.PutUint32(p, b.DefaultSampleSize)
+		p = p[4:]
+	}
+	if b.Has(TfhdDefaultSampleFlagsPresent) {
+		binary.BigEndian.PutUint32(p, b.DefaultSampleFlags)
+	}
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,189 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Track Fragment Random Access Box (tfra - optional)
+//
+// Contained in : Movie Fragment Random Access Box (mfra)
+//
+// Status: decoded
+//
+// Lists the sync samples of a track in the movie fragments: their presentation time (in the media
+// timescale), the offset of their moof box from the beginning of the file, and their track fragment,
+// track run and sample numbers in the moof box (starting at 1).
+//
+// Version 0 stores the times and offsets on 32 bits, version 1 on 64 bits. Version 1 is encoded when
+// Version is 1 or when a value doesn't fit in 32 bits. The numbers are stored on the fewest bytes
+// needed, or on the number of bytes they were decoded with.
+type TfraBox struct {
+	Version byte
+	Flags   [3]byte
+	header  [8]byte
+	TrackId uint32
+	Entries []TfraEntry
+	lengths byte
+}
+
+// An entry of a track fragment random access box
+type TfraEntry struct {
+	Time         uint64
+	MoofOffset   uint64
+	TrafNumber   uint32
+	TrunNumber   uint32
+	SampleNumber uint32
+}
+
+func DecodeTfra(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &TfraBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+		TrackId: binary.BigEndian.Uint32(data[4:8]),
+		lengths: data[11] & 0x3f,
+	}
+	c := binary.BigEndian.Uint32(data[12:16])
+	data = data[16:]
+	if uint64(c)*uint64(b.entrySize(b.Version, b.lengths)) > uint64(len(data)) {
+		return nil, ErrInvalidBoxSize
+	}
+	b.Entries = make([]TfraEntry, c)
+	for i := range b.Entries {
+		e := &b.Entries[i]
+		if b.Version == 1 {
+			e.Time = binary.BigEndian.Uint64(data[0:8])
+			e.MoofOffset = binary.BigEndian.Uint64(data[8:16])
+			data = data[16:]
+		} else {
+			e.Time = uint64(binary.BigEndian.Uint32(data[0:4]))
+			e.MoofOffset = uint64(binary.BigEndian.Uint32(data[4:8]))
+			data = data[8:]
+		}
+		for j, n := range []*uint32{&e.TrafNumber, &e.TrunNumber, &e.SampleNumber} {
+			l := int(b.lengths>>uint(4-2*j))&3 + 1
+			for k := 0; k < l; k++ {
+				*n = *n<<8 | uint32(data[k])
+			}
+			data = data[l:]
+		}
+	}
+	return b, nil
+}
+
+func (b *TfraBox) Type() string {
+	return "tfra"
+}
+
+func (b *TfraBox) version() byte {
+	if b.Version == 1 {
+		return 1
+	}
+	for _, e := range b.Entries {
+		if e.Time > math.MaxUint32 || e.MoofOffset > math.MaxUint32 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// lengthSizes returns the sizes of the traf, trun and sample numbers (minus one, 2 bits each)
+func (b *TfraBox) lengthSizes() byte {
+	var l [3]byte
+
+	for j := range l {
+		l[j] = b.lengths >> uint(4-2*j) & 3
+	}
+
+	for _, e := range b.Entries {
+		for j, n := range []uint32{e.TrafNumber, e.TrunNumber, e.SampleNumber} {
+			for n>>(8*(uint(l[j])+1)) != 0 && l[j] < 3 {
+				l[j]++
+			}
+		}
+	}
+
+	return l[0]<<4 | l[1]<<2 | l[2]
+}
+
+// entrySize returns the size of an entry
+func (b *TfraBox) entrySize(version, lengths byte) int {
+	sz := 8
+	if version == 1 {
+		sz = 16
+	}
+	return sz + int(lengths>>4&3+lengths>>2&3+lengths&3) + 3
+}
+
+func (b *TfraBox) Size() int {
+	return BoxHeaderSize + 16 + len(b.Entries)*b.entrySize(b.version(), b.lengthSizes())
+}
+
+// Lookup returns the last entry whose time is at or before a time (in the media timescale), or false
+// when there is none. Entries are sorted by time.
+func (b *TfraBox) Lookup(time uint64) (TfraEntry, bool) {
+	i := sort.Search(len(b.Entries), func(i int) bool {
+		return b.Entries[i].Time > time
+	})
+
+	if i == 0 {
+		return TfraEntry{}, false
+	}
+
+	return b.Entries[i-1], true
+}
+
+func (b *TfraBox) Dump() {
+	fmt.Printf("Track fragment random access: track %d, %d entries\n", b.TrackId, len(b.Entries))
+	for i, e := range b.Entries {
+		fmt.Printf(" #%d time %d, moof at %d, traf %d, trun %d, sample %d\n", i, e.Time, e.MoofOffset, e.TrafNumber, e.TrunNumber, e.SampleNumber)
+	}
+}
+
+func (b *TfraBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.version()
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.TrackId)
+	lengths := b.lengthSizes()
+	buf[11] = lengths
+	binary.BigEndian.PutUint32(buf[12:], uint32(len(b.Entries)))
+	data := buf[16:]
+	for _, e := range b.Entries {
+		if buf[0] == 1 {
+			binary.BigEndian.PutUint64(data[0:], e.Time)
+			binary.BigEndian.PutUint64(data[8:], e.MoofOffset)
+			data = data[16:]
+		} else {
+			binary.BigEndian.PutUint32(data[0:], uint32(e.Time))
+			binary.BigEndian.PutUint32(data[4:], uint32(e.MoofOffset))
+			data = data[8:]
+		}
+		for j, n := range []uint32{e.TrafNumber, e.TrunNumber, e.SampleNumber} {
+			l := int(lengths>>uint(4-2*j))&3 + 1
+			for k := l - 1; k >= 0; k-- {
+				data[k] = byte(n)
+				n >>= 8
+			}
+			data = data[l:]
+		}
+	}
+	_, err = w.Write(buf)
+	return err
+}
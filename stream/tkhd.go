@@ -4,11 +4,12 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 // Track Header Box (tkhd - mandatory)
 //
-// Status : only version 0 is decoded. version 1 is not supported
+// Status : decoded
 //
 // This box describes the track. Duration is measured in time units (according to the time scale
 // defined in the movie header box).
@@ -16,14 +17,16 @@ import (
 // Volume (relevant for audio tracks) is a fixed point number (8 bits + 8 bits). Full volume is 1.0.
 // Width and Height (relevant for video tracks) are fixed point numbers (16 bits + 16 bits).
 // Video pixels are not necessarily square.
+//
+// Times and duration are on 64 bits in version 1 (see MvhdBox).
 type TkhdBox struct {
 	Version          byte
 	Flags            [3]byte
 	header           [8]byte
-	CreationTime     uint32
-	ModificationTime uint32
+	CreationTime     uint64
+	ModificationTime uint64
 	TrackId          uint32
-	Duration         uint32
+	Duration         uint64
 	Layer            uint16
 	AlternateGroup   uint16 // should be int16
 	Volume           Fixed16
@@ -36,27 +39,69 @@ func DecodeTkhd(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(data) < 84 || data[0] == 1 && len(data) < 96 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &TkhdBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+	}
+	if b.Version == 1 {
+		b.CreationTime = binary.BigEndian.Uint64(data[4:12])
+		b.ModificationTime = binary.BigEndian.Uint64(data[12:20])
+		b.TrackId = binary.BigEndian.Uint32(data[20:24])
+		b.Duration = binary.BigEndian.Uint64(data[28:36])
+		data = data[36:]
+	} else {
+		b.CreationTime = uint64(binary.BigEndian.Uint32(data[4:8]))
+		b.ModificationTime = uint64(binary.BigEndian.Uint32(data[8:12]))
+		b.TrackId = binary.BigEndian.Uint32(data[12:16])
+		b.Duration = uint64(binary.BigEndian.Uint32(data[20:24]))
+		data = data[24:]
+	}
+	b.Layer = binary.BigEndian.Uint16(data[8:10])
+	b.AlternateGroup = binary.BigEndian.Uint16(data[10:12])
+	b.Volume = fixed16(data[12:14])
+	b.Matrix = data[16:52]
+	b.Width = fixed32(data[52:56])
+	b.Height = fixed32(data[56:60])
+	return b, nil
+}
+
+// NewTkhdBox returns a track header with the default values: the track is enabled, used in the
+// presentation and in the preview
+func NewTkhdBox(trackId uint32) *TkhdBox {
 	return &TkhdBox{
-		Version:          data[0],
-		Flags:            [3]byte{data[1], data[2], data[3]},
-		CreationTime:     binary.BigEndian.Uint32(data[4:8]),
-		ModificationTime: binary.BigEndian.Uint32(data[8:12]),
-		TrackId:          binary.BigEndian.Uint32(data[12:16]),
-		Volume:           fixed16(data[36:38]),
-		Duration:         binary.BigEndian.Uint32(data[20:24]),
-		Layer:            binary.BigEndian.Uint16(data[32:34]),
-		AlternateGroup:   binary.BigEndian.Uint16(data[34:36]),
-		Matrix:           data[40:76],
-		Width:            fixed32(data[76:80]),
-		Height:           fixed32(data[80:84]),
-	}, nil
+		Flags:   [3]byte{0, 0, 7},
+		TrackId: trackId,
+		Matrix:  unityMatrix(),
+	}
+}
+
+// unityMatrix returns the identity transformation matrix of movie and track headers
+func unityMatrix() []byte {
+	m := make([]byte, 36)
+	binary.BigEndian.PutUint32(m[0:], 0x10000)
+	binary.BigEndian.PutUint32(m[16:], 0x10000)
+	binary.BigEndian.PutUint32(m[32:], 0x40000000)
+	return m
 }
 
 func (b *TkhdBox) Type() string {
 	return "tkhd"
 }
 
+func (b *TkhdBox) version() byte {
+	if b.Version == 1 || b.CreationTime > math.MaxUint32 || b.ModificationTime > math.MaxUint32 || b.Duration > math.MaxUint32 {
+		return 1
+	}
+	return 0
+}
+
 func (b *TkhdBox) Size() int {
+	if b.version() == 1 {
+		return BoxHeaderSize + 96
+	}
 	return BoxHeaderSize + 84
 }
 
@@ -68,18 +113,27 @@ func (b *TkhdBox) Encode(w io.Writer) error {
 		return err
 	}
 	buf := makebuf(b)
-	buf[0] = b.Version
+	buf[0] = b.version()
 	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
-	binary.BigEndian.PutUint32(buf[4:], b.CreationTime)
-	binary.BigEndian.PutUint32(buf[8:], b.ModificationTime)
-	binary.BigEndian.PutUint32(buf[12:], b.TrackId)
-	binary.BigEndian.PutUint32(buf[20:], b.Duration)
-	binary.BigEndian.PutUint16(buf[32:], b.Layer)
-	binary.BigEndian.PutUint16(buf[34:], b.AlternateGroup)
-	putFixed16(buf[36:], b.Volume)
-	copy(buf[40:], b.Matrix)
-	putFixed32(buf[76:], b.Width)
-	putFixed32(buf[80:], b.Height)
+	n := 24
+	if buf[0] == 1 {
+		binary.BigEndian.PutUint64(buf[4:], b.CreationTime)
+		binary.BigEndian.PutUint64(buf[12:], b.ModificationTime)
+		binary.BigEndian.PutUint32(buf[20:], b.TrackId)
+		binary.BigEndian.PutUint64(buf[28:], b.Duration)
+		n = 36
+	} else {
+		binary.BigEndian.PutUint32(buf[4:], uint32(b.CreationTime))
+		binary.BigEndian.PutUint32(buf[8:], uint32(b.ModificationTime))
+		binary.BigEndian.PutUint32(buf[12:], b.TrackId)
+		binary.BigEndian.PutUint32(buf[20:], uint32(b.Duration))
+	}
+	binary.BigEndian.PutUint16(buf[n+8:], b.Layer)
+	binary.BigEndian.PutUint16(buf[n+10:], b.AlternateGroup)
+	putFixed16(buf[n+12:], b.Volume)
+	copy(buf[n+16:], b.Matrix)
+	putFixed32(buf[n+52:], b.Width)
+	putFixed32(buf[n+56:], b.Height)
 	_, err = w.Write(buf)
 	return err
 }
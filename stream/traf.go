@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"io"
+)
+
+// Track Fragment Box (traf - optional)
+//
+// Contained in : Movie Fragment Box (moof)
+//
+// Status: decoded
+//
+// Describes the samples of a track in a movie fragment: the header (tfhd) identifies the track and
+// overrides its default values, the track runs (trun) list the samples, and tfdt gives the decoding
+// time of the first sample.
+type TrafBox struct {
+	Tfhd  *TfhdBox
+	Tfdt  *TfdtBox
+	Trun  []*TrunBox
+	boxes []Box
+	order []Box
+}
+
+func DecodeTraf(r io.Reader) (Box, error) {
+	l, err := DecodeContainer(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &TrafBox{}
+	t.SetChildren(l)
+	return t, nil
+}
+
+func (b *TrafBox) Type() string {
+	return "traf"
+}
+
+func (b *TrafBox) Size() int {
+	return boxSize(boxesSize(b.children()))
+}
+
+func (b *TrafBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
+	}
+
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *TrafBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *TrafBox) SetChildren(l []Box) {
+	b.Tfhd, b.Tfdt, b.Trun, b.boxes = nil, nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *TfhdBox:
+			if b.Tfhd == nil {
+				b.Tfhd = c
+				continue
+			}
+		case *TfdtBox:
+			if b.Tfdt == nil {
+				b.Tfdt = c
+				continue
+			}
+		case *TrunBox:
+			b.Trun = append(b.Trun, c)
+			continue
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *TrafBox) children() []Box {
+	var l []Box
+	if b.Tfhd != nil {
+		l = append(l, b.Tfhd)
+	}
+	if b.Tfdt != nil {
+		l = append(l, b.Tfdt)
+	}
+	for _, c := range b.Trun {
+		l = append(l, c)
+	}
+	l = append(l, b.boxes...)
+	return l
+}
@@ -1,8 +1,8 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
+	"time"
 )
 
 // Track Box (tkhd - mandatory)
@@ -11,10 +11,11 @@ import (
 //
 // A media file can contain one or more tracks.
 type TrakBox struct {
-	Tkhd   *TkhdBox
-	Mdia   *MdiaBox
-	boxes  []Box
-	header [8]byte
+	Tkhd  *TkhdBox
+	Edts  *EdtsBox
+	Mdia  *MdiaBox
+	boxes []Box
+	order []Box
 }
 
 func DecodeTrak(r io.Reader) (Box, error) {
@@ -22,18 +23,13 @@ func DecodeTrak(r io.Reader) (Box, error) {
 	if err != nil {
 		return nil, err
 	}
-	t := &TrakBox{
-		boxes: make([]Box, 0, len(l)),
-	}
-	for _, b := range l {
-		switch b.Type() {
-		case "tkhd":
-			t.Tkhd = b.(*TkhdBox)
-		case "mdia":
-			t.Mdia = b.(*MdiaBox)
-		default:
-			t.boxes = append(t.boxes, b)
-		}
+	t := &TrakBox{}
+	t.SetChildren(l)
+	switch {
+	case t.Tkhd == nil:
+		return nil, missingBox("tkhd")
+	case t.Mdia == nil:
+		return nil, missingBox("mdia")
 	}
 	return t, nil
 }
@@ -42,39 +38,142 @@ func (b *TrakBox) Type() string {
 	return "trak"
 }
 
-func (b *TrakBox) Size() (sz int) {
-	sz += b.Tkhd.Size()
-	sz += b.Mdia.Size()
-
-	for _, box := range b.boxes {
-		sz += box.Size()
-	}
-
-	return sz + BoxHeaderSize
+func (b *TrakBox) Size() int {
+	return boxSize(boxesSize(b.children()))
 }
 
 func (b *TrakBox) Dump() {
 	b.Tkhd.Dump()
+	if b.Edts != nil {
+		b.Edts.Dump()
+	}
 	b.Mdia.Dump()
 }
 
-func (b *TrakBox) Encode(w io.Writer) (err error) {
-	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
-	copy(b.header[4:], b.Type())
-	_, err = w.Write(b.header[:])
-	if err != nil {
-		return
+func (b *TrakBox) Encode(w io.Writer) error {
+	if err := encodeHeader(w, b.Type(), b.Size(), false); err != nil {
+		return err
 	}
 
-	if err = b.Tkhd.Encode(w); err != nil {
-		return
+	return encodeChildren(w, b.order, b.children())
+}
+
+// Children returns the children of the box, in the encoding order
+func (b *TrakBox) Children() []Box {
+	return orderBoxes(b.order, b.children())
+}
+
+// SetChildren replaces the children of the box, which are encoded in the given order
+func (b *TrakBox) SetChildren(l []Box) {
+	b.Tkhd, b.Edts, b.Mdia, b.boxes = nil, nil, nil, nil
+	for _, c := range l {
+		switch c := c.(type) {
+		case *TkhdBox:
+			if b.Tkhd == nil {
+				b.Tkhd = c
+				continue
+			}
+		case *EdtsBox:
+			if b.Edts == nil {
+				b.Edts = c
+				continue
+			}
+		case *MdiaBox:
+			if b.Mdia == nil {
+				b.Mdia = c
+				continue
+			}
+		}
+		b.boxes = append(b.boxes, c)
+	}
+	b.order = append([]Box{}, l...)
+}
+
+// children returns the children of the box, in the default order
+func (b *TrakBox) children() []Box {
+	var l []Box
+	if b.Tkhd != nil {
+		l = append(l, b.Tkhd)
+	}
+	if b.Edts != nil {
+		l = append(l, b.Edts)
+	}
+	if b.Mdia != nil {
+		l = append(l, b.Mdia)
 	}
+	l = append(l, b.boxes...)
+	return l
+}
 
-	for _, b := range b.boxes {
-		if err = b.Encode(w); err != nil {
-			return
+// PresentationTime maps a media time (in media time units, see MdhdBox) to the presentation timeline,
+// according to the edit list of the track. movieTimescale is the timescale of the movie header (mvhd).
+//
+// Without edit list, the presentation time is the media time. ok is false when the media time is not presented.
+func (b *TrakBox) PresentationTime(mediaTime int64, movieTimescale uint32) (time.Duration, bool) {
+	if b.Edts == nil || b.Edts.Elst == nil || len(b.Edts.Elst.Entries) == 0 {
+		if mediaTime < 0 {
+			return 0, false
 		}
+		return UnitsToDuration(uint64(mediaTime), b.Mdia.Mdhd.Timescale), true
+	}
+	return b.Edts.Elst.PresentationTime(mediaTime, movieTimescale, b.Mdia.Mdhd.Timescale)
+}
+
+// MediaTime maps a presentation time to the media timeline (in media time units), the reverse of PresentationTime.
+func (b *TrakBox) MediaTime(d time.Duration, movieTimescale uint32) (int64, bool) {
+	if b.Edts == nil || b.Edts.Elst == nil || len(b.Edts.Elst.Entries) == 0 {
+		return int64(DurationToUnits(d, b.Mdia.Mdhd.Timescale)), d >= 0
+	}
+	return b.Edts.Elst.MediaTime(d, movieTimescale, b.Mdia.Mdhd.Timescale)
+}
+
+// Kind of media carried by a track, according to its handler type (see HdlrBox)
+type TrackKind int
+
+const (
+	TrackUnknown TrackKind = iota
+	TrackVideo
+	TrackAudio
+	TrackSubtitle
+	TrackHint
+	TrackMetadata
+	TrackTimecode
+)
+
+var trackKindNames = map[TrackKind]string{
+	TrackUnknown:  "unknown",
+	TrackVideo:    "video",
+	TrackAudio:    "audio",
+	TrackSubtitle: "subtitle",
+	TrackHint:     "hint",
+	TrackMetadata: "metadata",
+	TrackTimecode: "timecode",
+}
+
+func (k TrackKind) String() string {
+	return trackKindNames[k]
+}
+
+// Kind returns the kind of media of the track, TrackUnknown when the handler is missing or not known
+func (b *TrakBox) Kind() TrackKind {
+	if b.Mdia == nil || b.Mdia.Hdlr == nil {
+		return TrackUnknown
+	}
+
+	switch b.Mdia.Hdlr.HandlerType {
+	case "vide", "auxv", "pict":
+		return TrackVideo
+	case "soun":
+		return TrackAudio
+	case "text", "sbtl", "subt", "clcp":
+		return TrackSubtitle
+	case "hint":
+		return TrackHint
+	case "meta":
+		return TrackMetadata
+	case "tmcd":
+		return TrackTimecode
 	}
 
-	return b.Mdia.Encode(w)
+	return TrackUnknown
 }
@@ -0,0 +1,182 @@
+package stream
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SkipChildren is returned by a WalkFunc to skip the children of the box
+var SkipChildren = errors.New("skip children")
+
+var errStopWalk = errors.New("stop walk")
+
+// A Container is a box holding other boxes (moov, trak, stbl, stsd, udta, ...), or a media
+//
+// The typed fields of a container box (MoovBox.Trak for example) are among its children: SetChildren
+// updates them, and the sizes of the boxes follow the changes. The chunk offsets are not updated: moving
+// the media data needs them to be changed too (see StblBox.SetChunkOffsets).
+type Container interface {
+	// Children returns the children, in the encoding order
+	Children() []Box
+	// SetChildren replaces the children, which are encoded in the given order
+	SetChildren(l []Box)
+}
+
+// A WalkFunc is called by Walk for each box, parents being its containers from the root of the walk
+type WalkFunc func(b Box, parents []Container) error
+
+// Walk visits the boxes of a container, depth first, the container itself excluded
+//
+// When fn returns SkipChildren, the children of the box are not visited. Another error stops the walk,
+// and is returned by Walk.
+func Walk(c Container, fn WalkFunc) error {
+	err := walk(c, []Container{c}, fn)
+	if err == SkipChildren {
+		err = nil
+	}
+	return err
+}
+
+func walk(c Container, parents []Container, fn WalkFunc) error {
+	for _, b := range c.Children() {
+		err := fn(b, parents)
+		if err == SkipChildren {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if child, ok := b.(Container); ok {
+			if err = walk(child, append(parents[:len(parents):len(parents)], child), fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Parent returns the container of b within c, or nil
+func Parent(c Container, b Box) (parent Container) {
+	Walk(c, func(box Box, parents []Container) error {
+		if box == b {
+			parent = parents[len(parents)-1]
+			return errStopWalk
+		}
+		return nil
+	})
+	return
+}
+
+// Find returns the first box matching a path within c, or nil
+//
+// A path lists box types separated by slashes, for example "moov/udta/meta/ilst". A type may be followed
+// by an index among the children of that type, starting at 1: "moov/trak[2]/mdia/hdlr" is the handler
+// of the second track. The * type matches any box.
+func Find(c Container, path string) Box {
+	if l := find(c, path, true); len(l) > 0 {
+		return l[0]
+	}
+	return nil
+}
+
+// FindAll returns the boxes matching a path within c (see Find): "moov/trak/mdia/hdlr" lists the
+// handlers of all the tracks.
+func FindAll(c Container, path string) []Box {
+	return find(c, path, false)
+}
+
+func find(c Container, path string, first bool) (found []Box) {
+	steps := strings.Split(strings.Trim(path, "/"), "/")
+	containers := []Container{c}
+
+	for i, step := range steps {
+		ht, index := parseStep(step)
+		last := i == len(steps)-1
+
+		var next []Container
+
+		for _, parent := range containers {
+			n := 0
+			for _, b := range parent.Children() {
+				if ht != "*" && b.Type() != ht {
+					continue
+				}
+				if n++; index > 0 && n != index {
+					continue
+				}
+				if last {
+					found = append(found, b)
+					if first {
+						return
+					}
+				} else if child, ok := b.(Container); ok {
+					next = append(next, child)
+				}
+			}
+		}
+
+		containers = next
+	}
+
+	return
+}
+
+// parseStep parses a step of a path: a type and an optional index (0 when there is none)
+func parseStep(step string) (ht string, index int) {
+	if i := strings.IndexByte(step, '['); i >= 0 && strings.HasSuffix(step, "]") {
+		if n, err := strconv.Atoi(step[i+1 : len(step)-1]); err == nil && n > 0 {
+			return step[:i], n
+		}
+	}
+	return step, 0
+}
+
+// InsertChild inserts a box among the children of c, at index i (at the end when i is out of range)
+func InsertChild(c Container, i int, b Box) {
+	l := c.Children()
+	if i < 0 || i > len(l) {
+		i = len(l)
+	}
+
+	children := make([]Box, 0, len(l)+1)
+	children = append(children, l[:i]...)
+	children = append(children, b)
+	children = append(children, l[i:]...)
+
+	c.SetChildren(children)
+}
+
+// RemoveChild removes a box from the children of c. It returns false when b isn't a child of c.
+func RemoveChild(c Container, b Box) bool {
+	l := c.Children()
+
+	for i, child := range l {
+		if child == b {
+			children := make([]Box, 0, len(l)-1)
+			children = append(children, l[:i]...)
+			children = append(children, l[i+1:]...)
+			c.SetChildren(children)
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReplaceChild replaces a child of c by another box, at the same position. It returns false when old isn't
+// a child of c.
+func ReplaceChild(c Container, old, b Box) bool {
+	l := c.Children()
+
+	for i, child := range l {
+		if child == old {
+			children := append([]Box{}, l...)
+			children[i] = b
+			c.SetChildren(children)
+			return true
+		}
+	}
+
+	return false
+}
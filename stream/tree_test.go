@@ -0,0 +1,94 @@
+package stream
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// TestWalk walks the boxes of a media, and finds boxes by their paths
+func TestWalk(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "interleaved.mp4")]
+
+	m, err := DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdlr := m.Moov.Trak[1].Mdia.Hdlr
+	count := map[string]int{}
+
+	err = Walk(m, func(b Box, parents []Container) error {
+		count[b.Type()]++
+
+		if b == Box(hdlr) && (len(parents) != 4 || parents[0] != Container(m) || parents[1] != m.Moov || parents[3] != m.Moov.Trak[1].Mdia) {
+			t.Error("invalid parents of the handler box")
+		}
+
+		// The sample tables are not visited
+		if b.Type() == "stbl" {
+			return SkipChildren
+		}
+
+		return nil
+	})
+
+	if err != nil || count["trak"] != 2 || count["hdlr"] != 2 || count["stbl"] != 2 || count["stsd"] != 0 || count["cprt"] == 0 {
+		t.Fatalf("unexpected boxes visited %v (%v)", count, err)
+	}
+
+	if Parent(m, hdlr) != m.Moov.Trak[1].Mdia || Parent(m, m.Moov) != m || Parent(m.Moov.Trak[0], hdlr) != nil {
+		t.Fatal("invalid parent of a box")
+	}
+
+	if Find(m, "moov/trak[2]/mdia/hdlr") != hdlr || Find(m, "/moov/*[1]") != m.Moov.Mvhd || Find(m, "moov/*[1]/mdia") != nil || Find(m, "moov/trak[3]") != nil {
+		t.Fatal("invalid box found")
+	}
+
+	if l := FindAll(m, "moov/trak/mdia/hdlr"); len(l) != 2 || l[0] != m.Moov.Trak[0].Mdia.Hdlr || l[1] != hdlr {
+		t.Fatal("invalid boxes found")
+	}
+}
+
+// TestEditTree inserts, removes and replaces boxes, and checks the encoded media
+func TestEditTree(t *testing.T) {
+	src := testFiles(t)[filepath.Join("testdata", "reversed.mp4")]
+
+	m, err := DecodeSeeker(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := m.Moov.Size()
+	zzzz := NewUniBox("zzzz", []byte("inserted"))
+	trak := m.Moov.Trak[0]
+
+	InsertChild(m.Moov, 0, zzzz)
+
+	if !RemoveChild(m.Moov, trak) || RemoveChild(m.Moov, trak) || len(m.Moov.Trak) != 1 {
+		t.Fatal("the track isn't removed")
+	}
+
+	if !ReplaceChild(m.Moov, m.Moov.Mvhd, NewMvhdBox(600)) || m.Moov.Mvhd.Timescale != 600 {
+		t.Fatal("the movie header isn't replaced")
+	}
+
+	if m.Moov.Size() != size+zzzz.Size()-trak.Size() {
+		t.Fatalf("got moov size %d, want %d", m.Moov.Size(), size+zzzz.Size()-trak.Size())
+	}
+
+	var b bytes.Buffer
+
+	if err = m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := DecodeSeeker(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l := d.Moov.Children(); len(l) != 3 || l[0].Type() != "zzzz" || d.Moov.Mvhd.Timescale != 600 || len(d.Moov.Trak) != 1 {
+		t.Fatal("the encoded moov box doesn't have the edited children")
+	}
+}
@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// Track Extends Box (trex - mandatory in mvex)
+//
+// Contained in : Movie Extends Box (mvex)
+//
+// Status: decoded
+//
+// Sets up the default values used by the movie fragments of a track. A track fragment header (tfhd)
+// or a track run (trun) can override them.
+type TrexBox struct {
+	Version                       byte
+	Flags                         [3]byte
+	header                        [8]byte
+	TrackId                       uint32
+	DefaultSampleDescriptionIndex uint32
+	DefaultSampleDuration         uint32
+	DefaultSampleSize             uint32
+	DefaultSampleFlags            uint32
+}
+
+func DecodeTrex(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 {
+		return nil, ErrInvalidBoxSize
+	}
+	return &TrexBox{
+		Version:                       data[0],
+		Flags:                         [3]byte{data[1], data[2], data[3]},
+		TrackId:                       binary.BigEndian.Uint32(data[4:8]),
+		DefaultSampleDescriptionIndex: binary.BigEndian.Uint32(data[8:12]),
+		DefaultSampleDuration:         binary.BigEndian.Uint32(data[12:16]),
+		DefaultSampleSize:             binary.BigEndian.Uint32(data[16:20]),
+		DefaultSampleFlags:            binary.BigEndian.Uint32(data[20:24]),
+	}, nil
+}
+
+func (b *TrexBox) Type() string {
+	return "trex"
+}
+
+func (b *TrexBox) Size() int {
+	return BoxHeaderSize + 24
+}
+
+func (b *TrexBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], b.TrackId)
+	binary.BigEndian.PutUint32(buf[8:], b.DefaultSampleDescriptionIndex)
+	binary.BigEndian.PutUint32(buf[12:], b.DefaultSampleDuration)
+	binary.BigEndian.PutUint32(buf[16:], b.DefaultSampleSize)
+	binary.BigEndian.PutUint32(buf[20:], b.DefaultSampleFlags)
+	_, err = w.Write(buf)
+	return err
+}
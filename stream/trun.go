@@ -0,0 +1,202 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Flags of the track run box (trun)
+const (
+	TrunDataOffsetPresent                  = 0x000001
+	TrunFirstSampleFlagsPresent            = 0x000004
+	TrunSampleDurationPresent              = 0x000100
+	TrunSampleSizePresent                  = 0x000200
+	TrunSampleFlagsPresent                 = 0x000400
+	TrunSampleCompositionTimeOffsetPresent = 0x000800
+)
+
+// Sample flags (trex, tfhd and trun)
+const (
+	SampleFlagIsNonSync         = 0x00010000
+	SampleFlagDependsOnOthers   = 0x01000000
+	SampleFlagDependsOnNoOthers = 0x02000000
+)
+
+// maxTrunSamples is the largest number of samples of a track run whose samples have no field, to avoid
+// allocating a huge table for a malformed box
+const maxTrunSamples = 1 << 20
+
+// Track Run Box (trun - optional)
+//
+// Contained in : Track Fragment Box (traf)
+//
+// Status: decoded
+//
+// Lists contiguous samples of a track fragment. DataOffset is the position of the first sample, relative
+// to the base data offset of the track fragment (see tfhd). The sample fields are present according to
+// the flags (see Has and SetFlags), default values come from tfhd, then from trex.
+//
+// Composition time offsets are signed with version 1.
+type TrunBox struct {
+	Version          byte
+	Flags            [3]byte
+	header           [8]byte
+	DataOffset       int32
+	FirstSampleFlags uint32
+	Samples          []TrunSample
+}
+
+// A sample of a track run. Only the fields flagged in the track run are meaningful.
+type TrunSample struct {
+	Duration              uint32
+	Size                  uint32
+	Flags                 uint32
+	CompositionTimeOffset int32
+}
+
+func DecodeTrun(r io.Reader) (Box, error) {
+	data, err := readAllO(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8 {
+		return nil, ErrInvalidBoxSize
+	}
+	b := &TrunBox{
+		Version: data[0],
+		Flags:   [3]byte{data[1], data[2], data[3]},
+	}
+	c := binary.BigEndian.Uint32(data[4:8])
+	data = data[8:]
+	n := 0
+	if b.Has(TrunDataOffsetPresent) {
+		n += 4
+	}
+	if b.Has(TrunFirstSampleFlagsPresent) {
+		n += 4
+	}
+	if len(data) < n {
+		return nil, ErrInvalidBoxSize
+	}
+	if b.Has(TrunDataOffsetPresent) {
+		b.DataOffset = int32(binary.BigEndian.Uint32(data))
+		data = data[4:]
+	}
+	if b.Has(TrunFirstSampleFlagsPresent) {
+		b.FirstSampleFlags = binary.BigEndian.Uint32(data)
+		data = data[4:]
+	}
+	if n = b.sampleSize(); n > 0 && uint64(c)*uint64(n) > uint64(len(data)) || n == 0 && c > maxTrunSamples {
+		return nil, ErrInvalidBoxSize
+	}
+	b.Samples = make([]TrunSample, c)
+	for i := range b.Samples {
+		s := &b.Samples[i]
+		if b.Has(TrunSampleDurationPresent) {
+			s.Duration = binary.BigEndian.Uint32(data)
+			data = data[4:]
+		}
+		if b.Has(TrunSampleSizePresent) {
+			s.Size = binary.BigEndian.Uint32(data)
+			data = data[4:]
+		}
+		if b.Has(TrunSampleFlagsPresent) {
+			s.Flags = binary.BigEndian.Uint32(data)
+			data = data[4:]
+		}
+		if b.Has(TrunSampleCompositionTimeOffsetPresent) {
+			s.CompositionTimeOffset = int32(binary.BigEndian.Uint32(data))
+			data = data[4:]
+		}
+	}
+	return b, nil
+}
+
+func (b *TrunBox) Type() string {
+	return "trun"
+}
+
+// Has returns true when a flag is set
+func (b *TrunBox) Has(flag uint32) bool {
+	return flags24(b.Flags)&flag != 0
+}
+
+// SetFlags sets (or clears) flags
+func (b *TrunBox) SetFlags(flag uint32, set bool) {
+	if set {
+		b.Flags = putFlags24(flags24(b.Flags) | flag)
+	} else {
+		b.Flags = putFlags24(flags24(b.Flags) &^ flag)
+	}
+}
+
+// sampleSize returns the size of a sample entry
+func (b *TrunBox) sampleSize() (sz int) {
+	for _, f := range []uint32{TrunSampleDurationPresent, TrunSampleSizePresent, TrunSampleFlagsPresent, TrunSampleCompositionTimeOffsetPresent} {
+		if b.Has(f) {
+			sz += 4
+		}
+	}
+	return
+}
+
+func (b *TrunBox) Size() int {
+	sz := BoxHeaderSize + 8 + len(b.Samples)*b.sampleSize()
+	if b.Has(TrunDataOffsetPresent) {
+		sz += 4
+	}
+	if b.Has(TrunFirstSampleFlagsPresent) {
+		sz += 4
+	}
+	return sz
+}
+
+func (b *TrunBox) Dump() {
+	fmt.Printf("Track run: %d samples, data offset %d\n", len(b.Samples), b.DataOffset)
+	for i, s := range b.Samples {
+		fmt.Printf(" #%d : duration %d, size %d, flags %#x, composition offset %d\n", i, s.Duration, s.Size, s.Flags, s.CompositionTimeOffset)
+	}
+}
+
+func (b *TrunBox) Encode(w io.Writer) error {
+	binary.BigEndian.PutUint32(b.header[:4], uint32(b.Size()))
+	copy(b.header[4:], b.Type())
+	_, err := w.Write(b.header[:])
+	if err != nil {
+		return err
+	}
+	buf := makebuf(b)
+	buf[0] = b.Version
+	buf[1], buf[2], buf[3] = b.Flags[0], b.Flags[1], b.Flags[2]
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(b.Samples)))
+	p := buf[8:]
+	if b.Has(TrunDataOffsetPresent) {
+		binary.BigEndian.PutUint32(p, uint32(b.DataOffset))
+		p = p[4:]
+	}
+	if b.Has(TrunFirstSampleFlagsPresent) {
+		binary.BigEndian.PutUint32(p, b.FirstSampleFlags)
+		p = p[4:]
+	}
+	for _, s := range b.Samples {
+		if b.Has(TrunSampleDurationPresent) {
+			binary.BigEndian.PutUint32(p, s.Duration)
+			p = p[4:]
+		}
+		if b.Has(TrunSampleSizePresent) {
+			binary.BigEndian.PutUint32(p, s.Size)
+			p = p[4:]
+		}
+		if b.Has(TrunSampleFlagsPresent) {
+			binary.BigEndian.PutUint32(p, s.Flags)
+			p = p[4:]
+		}
+		if b.Has(TrunSampleCompositionTimeOffsetPresent) {
+			binary.BigEndian.PutUint32(p, uint32(s.CompositionTimeOffset))
+			p = p[4:]
+		}
+	}
+	_, err = w.Write(buf)
+	return err
+}
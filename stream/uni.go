@@ -1,7 +1,6 @@
 package stream
 
 import (
-	"encoding/binary"
 	"io"
 )
 
@@ -9,7 +8,6 @@ import (
 type UniBox struct {
 	name string
 	buff []byte
-	hbuf [BoxHeaderSize]byte
 }
 
 func DecodeUni(r io.Reader, name string) (Box, error) {
@@ -23,19 +21,24 @@ func DecodeUni(r io.Reader, name string) (Box, error) {
 	}, nil
 }
 
+// NewUniBox returns a box of the given type, holding raw content (header excluded)
+func NewUniBox(name string, content []byte) *UniBox {
+	return &UniBox{
+		name: name,
+		buff: content,
+	}
+}
+
 func (b *UniBox) Type() string {
 	return b.name
 }
 
 func (b *UniBox) Size() int {
-	return BoxHeaderSize + len(b.buff)
+	return boxSize(len(b.buff))
 }
 
 func (b *UniBox) Encode(w io.Writer) (err error) {
-	copy(b.hbuf[4:], b.Type())
-	binary.BigEndian.PutUint32(b.hbuf[:4], uint32(b.Size()))
-
-	if _, err = w.Write(b.hbuf[:]); err != nil {
+	if err = encodeHeader(w, b.Type(), b.Size(), false); err != nil {
 		return
 	}
 